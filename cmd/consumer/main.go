@@ -2,110 +2,144 @@ package main
 
 import (
 	"context"
+	"expvar"
 	"log"
 	"os"
 	"os/signal"
-	"sync"
 	"syscall"
 	"time"
 
 	"lmwn_gomeetup_failover/internal/db"
+	"lmwn_gomeetup_failover/internal/event"
 	"lmwn_gomeetup_failover/internal/health"
+	"lmwn_gomeetup_failover/internal/idempotency"
+	"lmwn_gomeetup_failover/internal/memlimit"
 	"lmwn_gomeetup_failover/internal/queue"
+	"lmwn_gomeetup_failover/internal/router"
 	"lmwn_gomeetup_failover/internal/service"
 )
 
 func main() {
+	// Step 0: Tune Go memory limit from the container memory limit
+	memGetter := memlimit.ProvideMemoryGetter()
+	memTuner := memlimit.NewGoMemLimitTuner(memGetter, memlimit.DefaultGoMemLimitRatio, memlimit.DefaultGoMemLimitRefreshInterval)
+	go memTuner.Start()
+
 	// Step 1: Initialize dependencies
 	mongo, err := db.NewMongoDB()
 	if err != nil {
 		log.Fatalf("Failed to initialize MongoDB: %v", err)
 	}
-	svc := service.NewService(mongo)
-	rmq, err := queue.NewRabbitMQ()
+	broker := newBroker()
+	svcCfg, err := service.ConfigFromEnv()
 	if err != nil {
-		log.Fatalf("Failed to initialize RabbitMQ: %v", err)
+		log.Fatalf("Invalid service config: %v", err)
 	}
+	svc := service.NewService(mongo, broker, svcCfg)
 
-	// Step 2: Start main business logic (HTTP Server)
-	ctx, cancelConsumer := context.WithCancel(context.Background())
-	wg := &sync.WaitGroup{}
-	StartConsumer(ctx, wg, rmq, svc)
-
-	// Step 3: Start Health Check Server
-	health.RunHealthCheck(mongo, rmq)
-
-	// Step 4: Handle graceful shutdown
+	processed := idempotency.NewStore(mongo, idempotency.DefaultLease, idempotency.DefaultRetention)
+	indexCtx, cancelIndex := context.WithTimeout(context.Background(), 10*time.Second)
+	if err := processed.EnsureIndexes(indexCtx); err != nil {
+		log.Printf("Failed to create processed message indexes: %v", err)
+	}
+	cancelIndex()
+
+	// Step 2: Start main business logic (Consumer)
+	consumer := StartConsumer(broker, svc, processed)
+
+	// Step 3: Watch memory pressure and shed load before the OOM killer fires
+	memWatcher := memlimit.NewWatcher(memGetter, memlimit.DefaultWatcherConfig())
+	memWatcher.OnChange(func(e memlimit.PressureEvent) {
+		svc.SetAcceptingTasks(e.Level == memlimit.PressureNone)
+		if e.Level == memlimit.PressureNone {
+			consumer.Resume("memory_pressure")
+		} else {
+			consumer.Pause("memory_pressure")
+		}
+	})
+	go memWatcher.Start()
+
+	// Step 4: Start Health Check Server
+	healthRegistry := health.NewRegistry()
+	memlimit.RegisterHealthChecks(healthRegistry, memGetter, memlimit.LowMemoryThreshold)
+	mongo.RegisterHealthChecks(healthRegistry)
+	if rmq, ok := broker.(*queue.RabbitMQ); ok {
+		rmq.RegisterHealthChecks(healthRegistry)
+	}
+	svc.RegisterHealthChecks(healthRegistry)
+	consumer.RegisterHealthChecks(healthRegistry)
+	// Stop pulling messages while they could only fail and be retried
+	consumer.PauseOnFailingChecks(healthRegistry, "mongodb", "circuit_breaker")
+	healthRegistry.Start()
+	healthServer := health.NewServer(health.AddrFromEnv(), healthRegistry)
+	go healthServer.Start()
+	healthServer.MarkStarted() // Startup is complete, let liveness and readiness probes take over
+
+	// Step 5: Handle graceful shutdown
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
 	<-ctx.Done()
+	healthServer.Drain(0) // No load balancer in front, only flip readiness
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	cancelConsumer() // Cancel the context to stop consumers
-	wg.Wait()        // Wait for all goroutines to finish
-
-	rmq.Stop(shutdownCtx)
+	consumer.Stop(shutdownCtx) // Stop consuming and wait for in-flight messages
 	svc.Shutdown(shutdownCtx)
+	broker.Stop(shutdownCtx)
 	mongo.Close(shutdownCtx)
+	healthServer.Stop(shutdownCtx)
+	healthRegistry.Stop(shutdownCtx)
+	memWatcher.Stop(shutdownCtx)
+	memTuner.Stop(shutdownCtx)
 
 	log.Println("Consumer shutdown complete.")
 }
 
-func StartConsumer(ctx context.Context, wg *sync.WaitGroup, rmq *queue.RabbitMQ, svc *service.Service) {
-	deliveries, err := rmq.GetConsumerChannel()
-	if err != nil {
-		log.Fatalf("Failed to start consumer: %v", err)
+// broker is what the consumer needs from RabbitMQ or the in-memory broker
+type broker interface {
+	queue.Publisher
+	queue.Consumer
+	Stop(ctx context.Context)
+}
+
+// newBroker connects to RabbitMQ, or with BROKER=memory uses an in-process broker for local runs
+// without RabbitMQ. The outbox relay of this process is then the only publisher, so messages are
+// only handled while no other binary relays the same outbox, and nothing survives a restart.
+func newBroker() broker {
+	cfg := queue.DefaultConfig()
+	if os.Getenv("BROKER") == "memory" {
+		log.Println("Using in-memory broker, messages are lost on restart")
+		return queue.NewMemory(1000, cfg.Retry)
 	}
 
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-
-		defer func() {
-			if r := recover(); r != nil {
-				log.Printf("Recovered from panic in consumer: %v", r)
-			}
-		}()
-
-		for {
-			select {
-			case <-ctx.Done():
-				log.Println("Context cancelled, stopping consumer...")
-				return
-			case msg, ok := <-deliveries:
-				if !ok {
-					log.Println("Delivery channel closed, attempting reconnect...")
-					// Try reconnecting only if context is not done
-					select {
-					case <-ctx.Done():
-						log.Println("Shutdown in progress, skipping reconnect.")
-						return
-					default:
-						rmq.Reconnect()
-						StartConsumer(ctx, wg, rmq, svc)
-						return
-					}
-				}
-
-				log.Printf("Received message: %s", msg.Body)
-
-				if svc.IsMessageProcessed(string(msg.Body)) {
-					log.Println("Skipping duplicate message")
-					msg.Ack(false)
-					continue
-				}
-
-				if err := svc.ProcessMessage(ctx, string(msg.Body)); err != nil {
-					log.Printf("Error processing message: %v", err)
-					msg.Nack(false, true)
-				} else {
-					msg.Ack(false)
-				}
-			}
-		}
-	}()
+	rmq, err := queue.NewRabbitMQ(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize RabbitMQ: %v", err)
+	}
+	return rmq
+}
 
+func StartConsumer(broker queue.Consumer, svc *service.Service, processed router.ProcessedStore) *queue.Runner {
+	r := router.New(router.UnknownDeadLetter)
+	r.Use(
+		router.Recovery(),
+		router.Logging(),
+		router.Metrics(expvar.NewMap("consumer_messages")),
+		router.Idempotency(processed), // Innermost, so only handled messages are marked processed
+	)
+	router.On(r, func(ctx context.Context, env event.Envelope, data *event.OrderCreated) error {
+		log.Printf("Handling %s event %s (schema v%d) for order %s", env.Type, env.ID, env.SchemaVersion, data.OrderID)
+		return svc.ProcessMessage(ctx, string(env.Data))
+	})
+
+	// Messages of the same order go to the same handler so they are processed in order
+	opts := queue.RunnerOptions{OrderingKey: queue.HeaderKey("order_id")}
+	consumer := queue.NewRunner(broker, queue.DefaultConsumerOptions(), opts, r.Handler())
+
+	if err := consumer.Start(); err != nil {
+		log.Fatalf("Failed to start consumer: %v", err)
+	}
 	log.Print("Consumer started successfully")
+	return consumer
 }
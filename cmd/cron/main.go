@@ -4,6 +4,8 @@ import (
 	"context"
 	"lmwn_gomeetup_failover/internal/db"
 	"lmwn_gomeetup_failover/internal/health"
+	"lmwn_gomeetup_failover/internal/memlimit"
+	"lmwn_gomeetup_failover/internal/queue"
 	"lmwn_gomeetup_failover/internal/service"
 	"log"
 	"os"
@@ -57,13 +59,25 @@ func performTask(svc *service.Service) {
 }
 
 func main() {
+	// Step 0: Tune Go memory limit from the container memory limit
+	memGetter := memlimit.ProvideMemoryGetter()
+	memTuner := memlimit.NewGoMemLimitTuner(memGetter, memlimit.DefaultGoMemLimitRatio, memlimit.DefaultGoMemLimitRefreshInterval)
+	go memTuner.Start()
+
 	// Step 1: Initialize dependencies
 	mongo, err := db.NewMongoDB()
 	if err != nil {
 		log.Fatalf("Failed to initialize MongoDB: %v", err)
 	}
-
-	svc := service.NewService(mongo)
+	rmq, err := queue.NewRabbitMQ(queue.DefaultConfig())
+	if err != nil {
+		log.Fatalf("Failed to initialize RabbitMQ: %v", err)
+	}
+	svcCfg, err := service.ConfigFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid service config: %v", err)
+	}
+	svc := service.NewService(mongo, rmq, svcCfg)
 
 	// Step 2: Start main business logic (HTTP Server)
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
@@ -72,11 +86,25 @@ func main() {
 	interval := 10 * time.Second // Adjust interval as needed
 	runCronJob(ctx, wg, interval, svc)
 
-	// Step 3: Start Health Check Server
-	health.RunHealthCheck(mongo, nil)
+	// Step 3: Watch memory pressure and shed load before the OOM killer fires
+	memWatcher := memlimit.NewWatcher(memGetter, memlimit.DefaultWatcherConfig())
+	memWatcher.OnChange(func(e memlimit.PressureEvent) {
+		svc.SetAcceptingTasks(e.Level == memlimit.PressureNone)
+	})
+	go memWatcher.Start()
 
-	// Step 4: Handle graceful shutdown
+	// Step 4: Start Health Check Server
+	healthRegistry := health.NewRegistry()
+	memlimit.RegisterHealthChecks(healthRegistry, memGetter, memlimit.LowMemoryThreshold)
+	mongo.RegisterHealthChecks(healthRegistry)
+	healthRegistry.Start()
+	healthServer := health.NewServer(health.AddrFromEnv(), healthRegistry)
+	go healthServer.Start()
+	healthServer.MarkStarted() // Startup is complete, let liveness and readiness probes take over
+
+	// Step 5: Handle graceful shutdown
 	<-ctx.Done()
+	healthServer.Drain(0) // No load balancer in front, only flip readiness
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
@@ -92,4 +120,12 @@ func main() {
 	case <-shutdownCtx.Done():
 		log.Println("Cron shutdown timeout exceeded, forcing stop.")
 	}
+
+	svc.Shutdown(shutdownCtx)
+	rmq.Stop(shutdownCtx)
+	mongo.Close(shutdownCtx)
+	healthServer.Stop(shutdownCtx)
+	healthRegistry.Stop(shutdownCtx)
+	memWatcher.Stop(shutdownCtx)
+	memTuner.Stop(shutdownCtx)
 }
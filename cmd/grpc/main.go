@@ -11,17 +11,35 @@ import (
 	"lmwn_gomeetup_failover/internal/db"
 	"lmwn_gomeetup_failover/internal/grpc"
 	"lmwn_gomeetup_failover/internal/health"
+	"lmwn_gomeetup_failover/internal/memlimit"
+	"lmwn_gomeetup_failover/internal/queue"
 	"lmwn_gomeetup_failover/internal/service"
 )
 
 func main() {
+	// Step 0: Tune Go memory limit from the container memory limit
+	memGetter := memlimit.ProvideMemoryGetter()
+	memTuner := memlimit.NewGoMemLimitTuner(memGetter, memlimit.DefaultGoMemLimitRatio, memlimit.DefaultGoMemLimitRefreshInterval)
+	go memTuner.Start()
+
 	// Step 1: Initialize dependencies
 	mongo, err := db.NewMongoDB()
 	if err != nil {
 		log.Fatalf("Failed to initialize MongoDB: %v", err)
 	}
-	svc := service.NewService(mongo)
-	server, err := grpc.NewGRPCServer(svc)
+	rmq, err := queue.NewRabbitMQ(queue.DefaultConfig())
+	if err != nil {
+		log.Fatalf("Failed to initialize RabbitMQ: %v", err)
+	}
+	svcCfg, err := service.ConfigFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid service config: %v", err)
+	}
+	svc := service.NewService(mongo, rmq, svcCfg)
+	healthRegistry := health.NewRegistry()
+	memlimit.RegisterHealthChecks(healthRegistry, memGetter, memlimit.LowMemoryThreshold)
+	mongo.RegisterHealthChecks(healthRegistry)
+	server, err := grpc.NewGRPCServer(svc, healthRegistry)
 	if err != nil {
 		log.Fatalf("Failed to initialize gRPC server: %v", err)
 	}
@@ -29,17 +47,37 @@ func main() {
 	// Step 2: Start main business logic (HTTP Server)
 	go server.Start()
 
-	// Step 3: Start Health Check Server
-	health.RunHealthCheck(mongo, nil)
+	// Step 3: Watch memory pressure and shed load before the OOM killer fires
+	memWatcher := memlimit.NewWatcher(memGetter, memlimit.DefaultWatcherConfig())
+	memWatcher.OnChange(func(e memlimit.PressureEvent) {
+		svc.SetAcceptingTasks(e.Level == memlimit.PressureNone)
+	})
+	go memWatcher.Start()
+
+	// Step 4: Start Health Check Server
+	healthRegistry.Start()
+	healthServer := health.NewServer(health.AddrFromEnv(), healthRegistry)
+	go healthServer.Start()
+	healthServer.MarkStarted() // Startup is complete, let liveness and readiness probes take over
 
-	// Step 4: Handle graceful shutdown
+	// Step 5: Handle graceful shutdown
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 	<-ctx.Done() // Wait for termination signal
+
+	// Fail readiness first so load balancers deregister the pod before the servers stop
+	server.Drain()
+	healthServer.Drain(5 * time.Second)
+
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
 	server.Stop(shutdownCtx)
 	svc.Shutdown(shutdownCtx)
+	rmq.Stop(shutdownCtx)
 	mongo.Close(shutdownCtx)
+	healthServer.Stop(shutdownCtx)
+	healthRegistry.Stop(shutdownCtx)
+	memWatcher.Stop(shutdownCtx)
+	memTuner.Stop(shutdownCtx)
 }
@@ -1,9 +1,13 @@
 package circuitbreaker
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"time"
 
+	"lmwn_gomeetup_failover/internal/health"
+
 	"github.com/sony/gobreaker"
 )
 
@@ -32,3 +36,24 @@ func NewCircuitBreaker() *CircuitBreaker {
 func (cb *CircuitBreaker) Execute(req func() (interface{}, error)) (interface{}, error) {
 	return cb.cb.Execute(req)
 }
+
+// IsOpen reports whether the breaker is rejecting calls
+func (cb *CircuitBreaker) IsOpen() bool {
+	return cb.cb.State() == gobreaker.StateOpen
+}
+
+// RegisterHealthChecks reports the breaker as a non-critical check that fails while it is open.
+// The breaker already debounces failures, so the check trips on the first failed run.
+func (cb *CircuitBreaker) RegisterHealthChecks(registry *health.Registry, name string) {
+	registry.Register(health.Check{
+		Name: name,
+		Checker: health.CheckerFunc(func(ctx context.Context) error {
+			if cb.IsOpen() {
+				return errors.New("circuit breaker is open")
+			}
+			return nil
+		}),
+		Interval:         time.Second,
+		FailureThreshold: 1,
+	})
+}
@@ -0,0 +1,145 @@
+package event
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// SpecVersion is the CloudEvents version the envelope follows
+	SpecVersion = "1.0"
+	// Source identifies this service as the producer of the events
+	Source = "/order-service"
+	// ContentType is the content type of an encoded envelope, CloudEvents structured mode
+	ContentType = "application/cloudevents+json"
+)
+
+// ErrInvalidEvent is wrapped by every validation error
+var ErrInvalidEvent = errors.New("invalid event")
+
+// Payload is the typed data carried by an envelope
+type Payload interface {
+	EventType() string
+	SchemaVersion() int
+	Validate() error
+}
+
+// Envelope is a CloudEvents 1.0 event in JSON format. SchemaVersion is an extension
+// attribute that versions Data independently of the event type.
+type Envelope struct {
+	ID              string          `json:"id"`
+	Type            string          `json:"type"`
+	Source          string          `json:"source"`
+	SpecVersion     string          `json:"specversion"`
+	Time            time.Time       `json:"time"`
+	Subject         string          `json:"subject,omitempty"`
+	DataContentType string          `json:"datacontenttype,omitempty"`
+	SchemaVersion   int             `json:"schemaversion"`
+	Data            json.RawMessage `json:"data"`
+}
+
+// New wraps data in an envelope with a fresh ID; subject is the entity the event is about, e.g. the order ID
+func New(data Payload, subject string) (Envelope, error) {
+	if err := data.Validate(); err != nil {
+		return Envelope{}, err
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return Envelope{}, err
+	}
+	return Envelope{
+		ID:              uuid.NewString(),
+		Type:            data.EventType(),
+		Source:          Source,
+		SpecVersion:     SpecVersion,
+		Time:            time.Now().UTC(),
+		Subject:         subject,
+		DataContentType: "application/json",
+		SchemaVersion:   data.SchemaVersion(),
+		Data:            raw,
+	}, nil
+}
+
+// Validate checks the attributes CloudEvents requires plus the ones this service relies on
+func (e Envelope) Validate() error {
+	switch {
+	case e.ID == "":
+		return fmt.Errorf("%w: missing id", ErrInvalidEvent)
+	case e.Type == "":
+		return fmt.Errorf("%w: missing type", ErrInvalidEvent)
+	case e.Source == "":
+		return fmt.Errorf("%w: missing source", ErrInvalidEvent)
+	case e.SpecVersion != SpecVersion:
+		return fmt.Errorf("%w: unsupported specversion %q", ErrInvalidEvent, e.SpecVersion)
+	case e.Time.IsZero():
+		return fmt.Errorf("%w: missing time", ErrInvalidEvent)
+	case e.SchemaVersion <= 0:
+		return fmt.Errorf("%w: missing schemaversion", ErrInvalidEvent)
+	case len(e.Data) == 0:
+		return fmt.Errorf("%w: missing data", ErrInvalidEvent)
+	}
+	return nil
+}
+
+// Encode validates the envelope and marshals it to JSON
+func Encode(e Envelope) ([]byte, error) {
+	if err := e.Validate(); err != nil {
+		return nil, err
+	}
+	return json.Marshal(e)
+}
+
+// Decode unmarshals and validates an envelope; the data is left raw, see DecodeData
+func Decode(body []byte) (Envelope, error) {
+	var e Envelope
+	if err := json.Unmarshal(body, &e); err != nil {
+		return Envelope{}, fmt.Errorf("%w: %v", ErrInvalidEvent, err)
+	}
+	if err := e.Validate(); err != nil {
+		return Envelope{}, err
+	}
+	return e, nil
+}
+
+// DecodeData unmarshals the envelope data into v and validates it. The envelope type must match
+// and its schema version must not be newer than the one v understands.
+func (e Envelope) DecodeData(v Payload) error {
+	if e.Type != v.EventType() {
+		return fmt.Errorf("%w: type %q does not match %q", ErrInvalidEvent, e.Type, v.EventType())
+	}
+	if e.SchemaVersion > v.SchemaVersion() {
+		return fmt.Errorf("%w: %s schema version %d is newer than supported version %d", ErrInvalidEvent, e.Type, e.SchemaVersion, v.SchemaVersion())
+	}
+	if err := json.Unmarshal(e.Data, v); err != nil {
+		return fmt.Errorf("%w: %s data: %v", ErrInvalidEvent, e.Type, err)
+	}
+	return v.Validate()
+}
+
+// registry creates an empty payload for each known event type
+var registry = map[string]func() Payload{}
+
+func register(newPayload func() Payload) {
+	registry[newPayload().EventType()] = newPayload
+}
+
+// Parse decodes an envelope and its typed data, failing on unknown event types
+func Parse(body []byte) (Envelope, Payload, error) {
+	e, err := Decode(body)
+	if err != nil {
+		return Envelope{}, nil, err
+	}
+	newPayload, ok := registry[e.Type]
+	if !ok {
+		return e, nil, fmt.Errorf("%w: unknown type %q", ErrInvalidEvent, e.Type)
+	}
+	data := newPayload()
+	if err := e.DecodeData(data); err != nil {
+		return e, nil, err
+	}
+	return e, data, nil
+}
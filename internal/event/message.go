@@ -0,0 +1,153 @@
+package event
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+const (
+	// ProtobufContentType sends events in CloudEvents binary mode: the body is the protobuf
+	// encoded data and the envelope attributes travel as headers
+	ProtobufContentType = "application/protobuf"
+	// headerPrefix is the CloudEvents AMQP binding prefix for attribute headers
+	headerPrefix = "cloudEvents:"
+)
+
+// ProtoPayload is a payload that can also be encoded as protobuf
+type ProtoPayload interface {
+	Payload
+	MarshalProto() ([]byte, error)
+	UnmarshalProto(b []byte) error
+}
+
+// Message is an encoded event ready to be published
+type Message struct {
+	ContentType string
+	Headers     map[string]string
+	Body        []byte
+}
+
+// EncodeMessage encodes the envelope for the queue. ContentType (the default) produces a
+// structured JSON envelope, ProtobufContentType produces protobuf data with attribute headers.
+func EncodeMessage(e Envelope, contentType string) (Message, error) {
+	switch contentType {
+	case "", ContentType:
+		body, err := Encode(e)
+		if err != nil {
+			return Message{}, err
+		}
+		return Message{ContentType: ContentType, Body: body}, nil
+	case ProtobufContentType:
+		if err := e.Validate(); err != nil {
+			return Message{}, err
+		}
+		data, err := protoPayload(e.Type)
+		if err != nil {
+			return Message{}, err
+		}
+		if err := e.DecodeData(data); err != nil {
+			return Message{}, err
+		}
+		body, err := data.MarshalProto()
+		if err != nil {
+			return Message{}, err
+		}
+		return Message{ContentType: ProtobufContentType, Headers: attributeHeaders(e), Body: body}, nil
+	default:
+		return Message{}, fmt.Errorf("%w: unsupported content type %q", ErrInvalidEvent, contentType)
+	}
+}
+
+// DecodeMessage decodes and validates a message from the queue, picking the encoding from its content type.
+// Messages without a content type are treated as JSON for compatibility.
+func DecodeMessage(contentType string, headers map[string]interface{}, body []byte) (Envelope, Payload, error) {
+	switch contentType {
+	case "", "application/json", ContentType:
+		return Parse(body)
+	case ProtobufContentType:
+		e, err := envelopeFromHeaders(headers)
+		if err != nil {
+			return Envelope{}, nil, err
+		}
+		data, err := protoPayload(e.Type)
+		if err != nil {
+			return e, nil, err
+		}
+		if e.SchemaVersion > data.SchemaVersion() {
+			return e, nil, fmt.Errorf("%w: %s schema version %d is newer than supported version %d", ErrInvalidEvent, e.Type, e.SchemaVersion, data.SchemaVersion())
+		}
+		if err := data.UnmarshalProto(body); err != nil {
+			return e, nil, fmt.Errorf("%w: %s data: %v", ErrInvalidEvent, e.Type, err)
+		}
+		if err := data.Validate(); err != nil {
+			return e, nil, err
+		}
+		// Keep Data in its JSON form so handlers see the same envelope whatever the encoding
+		if e.Data, err = json.Marshal(data); err != nil {
+			return e, nil, err
+		}
+		e.DataContentType = "application/json"
+		return e, data, e.Validate()
+	default:
+		return Envelope{}, nil, fmt.Errorf("%w: unsupported content type %q", ErrInvalidEvent, contentType)
+	}
+}
+
+func protoPayload(eventType string) (ProtoPayload, error) {
+	newPayload, ok := registry[eventType]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown type %q", ErrInvalidEvent, eventType)
+	}
+	data, ok := newPayload().(ProtoPayload)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s has no protobuf encoding", ErrInvalidEvent, eventType)
+	}
+	return data, nil
+}
+
+func attributeHeaders(e Envelope) map[string]string {
+	headers := map[string]string{
+		headerPrefix + "id":            e.ID,
+		headerPrefix + "type":          e.Type,
+		headerPrefix + "source":        e.Source,
+		headerPrefix + "specversion":   e.SpecVersion,
+		headerPrefix + "time":          e.Time.Format(time.RFC3339Nano),
+		headerPrefix + "schemaversion": strconv.Itoa(e.SchemaVersion),
+	}
+	if e.Subject != "" {
+		headers[headerPrefix+"subject"] = e.Subject
+	}
+	return headers
+}
+
+func envelopeFromHeaders(headers map[string]interface{}) (Envelope, error) {
+	get := func(name string) string {
+		v, _ := headers[headerPrefix+name].(string)
+		return v
+	}
+
+	e := Envelope{
+		ID:          get("id"),
+		Type:        get("type"),
+		Source:      get("source"),
+		SpecVersion: get("specversion"),
+		Subject:     get("subject"),
+	}
+	if t := get("time"); t != "" {
+		parsed, err := time.Parse(time.RFC3339Nano, t)
+		if err != nil {
+			return Envelope{}, fmt.Errorf("%w: time: %v", ErrInvalidEvent, err)
+		}
+		e.Time = parsed
+	}
+	if v := get("schemaversion"); v != "" {
+		version, err := strconv.Atoi(v)
+		if err != nil {
+			return Envelope{}, fmt.Errorf("%w: schemaversion: %v", ErrInvalidEvent, err)
+		}
+		e.SchemaVersion = version
+	}
+	return e, nil
+}
@@ -0,0 +1,49 @@
+package event
+
+import (
+	"fmt"
+
+	pb "lmwn_gomeetup_failover/proto"
+
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	TypeOrderCreated = "order.created"
+)
+
+func init() {
+	register(func() Payload { return &OrderCreated{} })
+}
+
+// OrderCreated is published once an order has been stored
+type OrderCreated struct {
+	OrderID string `json:"orderId"`
+	Status  string `json:"status"`
+}
+
+func (*OrderCreated) EventType() string  { return TypeOrderCreated }
+func (*OrderCreated) SchemaVersion() int { return 1 }
+
+func (o *OrderCreated) Validate() error {
+	if o.OrderID == "" {
+		return fmt.Errorf("%w: %s: missing orderId", ErrInvalidEvent, TypeOrderCreated)
+	}
+	if o.Status == "" {
+		return fmt.Errorf("%w: %s: missing status", ErrInvalidEvent, TypeOrderCreated)
+	}
+	return nil
+}
+
+func (o *OrderCreated) MarshalProto() ([]byte, error) {
+	return proto.Marshal(&pb.OrderCreatedEvent{OrderId: o.OrderID, Status: o.Status})
+}
+
+func (o *OrderCreated) UnmarshalProto(b []byte) error {
+	var m pb.OrderCreatedEvent
+	if err := proto.Unmarshal(b, &m); err != nil {
+		return err
+	}
+	o.OrderID, o.Status = m.OrderId, m.Status
+	return nil
+}
@@ -16,7 +16,7 @@ type OrderService struct {
 func (o *OrderService) CreateOrder(ctx context.Context, req *pb.CreateOrderRequest) (*pb.CreateOrderResponse, error) {
 	param := req.Param
 	log.Printf("gRPC: Creating order %s", param)
-	orderID, err := o.service.CreateOrder(param)
+	orderID, err := o.service.CreateOrder(ctx, param)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,72 @@
+package grpc
+
+import (
+	"sync"
+	"time"
+
+	"lmwn_gomeetup_failover/internal/health"
+	pb "lmwn_gomeetup_failover/proto"
+
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// healthRefreshInterval is how often the statuses are re-read from the registry. OnChange only
+// fires when a check result changes, while stale checks and expiring flap windows change the
+// report without one.
+const healthRefreshInterval = time.Second
+
+// healthService publishes the registry checks through the standard grpc.health.v1.Health service.
+// The server-wide status ("") follows liveness, OrderService follows readiness.
+type healthService struct {
+	server   *grpchealth.Server
+	registry *health.Registry
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+func newHealthService(registry *health.Registry) *healthService {
+	h := &healthService{
+		server:   grpchealth.NewServer(),
+		registry: registry,
+		stop:     make(chan struct{}),
+	}
+	h.update()
+	registry.OnChange(h.update)
+	go h.refresh()
+	return h
+}
+
+// refresh keeps the statuses in line with /livez and /readyz until the service is drained
+func (h *healthService) refresh() {
+	ticker := time.NewTicker(healthRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-h.stop:
+			return
+		case <-ticker.C:
+			h.update()
+		}
+	}
+}
+
+func (h *healthService) update() {
+	h.server.SetServingStatus("", servingStatus(h.registry.Liveness()))
+	h.server.SetServingStatus(pb.OrderService_ServiceDesc.ServiceName, servingStatus(h.registry.Readiness()))
+}
+
+// drain reports NOT_SERVING for every service and ignores later updates
+func (h *healthService) drain() {
+	h.stopOnce.Do(func() { close(h.stop) })
+	h.server.Shutdown()
+}
+
+func servingStatus(report health.Report) healthpb.HealthCheckResponse_ServingStatus {
+	if report.Healthy() {
+		return healthpb.HealthCheckResponse_SERVING
+	}
+	return healthpb.HealthCheckResponse_NOT_SERVING
+}
@@ -6,20 +6,23 @@ import (
 	"net"
 	"runtime/debug"
 
+	"lmwn_gomeetup_failover/internal/health"
 	"lmwn_gomeetup_failover/internal/service"
 	pb "lmwn_gomeetup_failover/proto"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/status"
 )
 
 type GRPCServer struct {
 	server   *grpc.Server
 	listener net.Listener
+	health   *healthService
 }
 
-func NewGRPCServer(svc *service.Service) (*GRPCServer, error) {
+func NewGRPCServer(svc *service.Service, registry *health.Registry) (*GRPCServer, error) {
 	listener, err := net.Listen("tcp", ":50051")
 	if err != nil {
 		return nil, err
@@ -30,9 +33,13 @@ func NewGRPCServer(svc *service.Service) (*GRPCServer, error) {
 	)
 	pb.RegisterOrderServiceServer(grpcServer, &OrderService{service: svc})
 
+	healthSvc := newHealthService(registry)
+	healthpb.RegisterHealthServer(grpcServer, healthSvc.server)
+
 	return &GRPCServer{
 		server:   grpcServer,
 		listener: listener,
+		health:   healthSvc,
 	}, nil
 }
 
@@ -60,8 +67,14 @@ func (g *GRPCServer) Start() {
 	}
 }
 
+// Drain makes the gRPC health service report NOT_SERVING so clients stop sending new calls
+func (g *GRPCServer) Drain() {
+	g.health.drain()
+}
+
 func (g *GRPCServer) Stop(ctx context.Context) {
 	log.Println("Shutting down gRPC server...")
+	g.health.drain()
 	done := make(chan struct{})
 	go func() {
 		g.server.GracefulStop()
@@ -1,40 +1,116 @@
 package health
 
 import (
-	"lmwn_gomeetup_failover/internal/db"
-	"lmwn_gomeetup_failover/internal/memlimit"
-	"lmwn_gomeetup_failover/internal/queue"
+	"context"
+	"encoding/json"
+	"expvar"
 	"log"
 	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
 )
 
-func RunHealthCheck(mongo *db.MongoDB, rabbitmq *queue.RabbitMQ) {
-	mux := http.NewServeMux()
+// DefaultAddr is the address the health server listens on unless configured otherwise
+const DefaultAddr = ":18080"
 
-	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		isLowMem, err := memlimit.IsInLowMemory(memlimit.ProvideMemoryGetter(), true, 80)
+// AddrFromEnv returns HEALTH_ADDR, or DefaultAddr when it is not set.
+// Binaries sharing a host need different addresses, e.g. HEALTH_ADDR=:18081.
+func AddrFromEnv() string {
+	if addr := os.Getenv("HEALTH_ADDR"); addr != "" {
+		return addr
+	}
+	return DefaultAddr
+}
 
-		if (mongo != nil && !mongo.IsConnected()) ||
-			(rabbitmq != nil && !rabbitmq.IsConnected()) ||
-			(isLowMem || err != nil) {
+// Server serves the Kubernetes probe endpoints:
+//   - /livez fails only when a critical liveness check fails, so the pod is restarted
+//   - /readyz fails when a critical dependency is down or the pod is draining, so it is taken out of the load balancer
+//   - /startupz fails until MarkStarted is called, holding off the other probes during boot
+type Server struct {
+	server   *http.Server
+	registry *Registry
+	started  atomic.Bool
+	draining atomic.Bool
+}
 
-			w.WriteHeader(http.StatusServiceUnavailable)
-			w.Write([]byte(`{"status": "unhealthy"}`))
-			return
-		}
+func NewServer(addr string, registry *Registry) *Server {
+	s := &Server{registry: registry}
 
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte(`{"status": "healthy"}`))
+	mux := http.NewServeMux()
+	mux.HandleFunc("/livez", func(w http.ResponseWriter, r *http.Request) {
+		writeReport(w, registry.Liveness())
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		writeReport(w, s.gate(registry.Readiness()))
+	})
+	mux.HandleFunc("/startupz", func(w http.ResponseWriter, r *http.Request) {
+		report := Report{Status: StatusHealthy, Checks: map[string]CheckResult{}}
+		if !s.started.Load() {
+			report.Status = StatusStarting
+		}
+		writeReport(w, report)
+	})
+	// Counters published with expvar, e.g. consumer message metrics
+	mux.Handle("/debug/vars", expvar.Handler())
+	// /health is kept for existing monitors and reports every registered check
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		writeReport(w, s.gate(registry.Snapshot(nil)))
 	})
 
-	srv := &http.Server{
-		Addr:    ":18080",
+	s.server = &http.Server{
+		Addr:    addr,
 		Handler: mux,
 	}
+	return s
+}
 
-	go func() {
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Printf("Health check server error: %v", err)
-		}
-	}()
+// gate overrides the report while the pod is still starting or already draining
+func (s *Server) gate(report Report) Report {
+	if s.draining.Load() {
+		report.Status = StatusDraining
+	} else if !s.started.Load() {
+		report.Status = StatusStarting
+	}
+	return report
+}
+
+// MarkStarted signals that startup has finished and the main servers are running
+func (s *Server) MarkStarted() {
+	s.started.Store(true)
+}
+
+// Drain flips readiness to failing and waits for load balancers to deregister the pod.
+// Call it on SIGTERM before shutting down the main servers.
+func (s *Server) Drain(wait time.Duration) {
+	s.draining.Store(true)
+	log.Printf("Draining: readiness is failing, waiting %s before shutdown", wait)
+	time.Sleep(wait)
+}
+
+func (s *Server) Start() {
+	log.Printf("Starting health check server on %s", s.server.Addr)
+	if err := s.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Printf("Health check server error: %v", err)
+	}
+}
+
+func (s *Server) Stop(ctx context.Context) {
+	log.Println("Shutting down health check server...")
+	if err := s.server.Shutdown(ctx); err != nil {
+		log.Printf("Health check server forced to shutdown: %v", err)
+	}
+	log.Println("Health check server shutdown complete.")
+}
+
+func writeReport(w http.ResponseWriter, report Report) {
+	w.Header().Set("Content-Type", "application/json")
+	if report.Healthy() {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		log.Printf("Failed to write health report: %v", err)
+	}
 }
@@ -0,0 +1,399 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	StatusHealthy   = "healthy"
+	StatusDegraded  = "degraded"
+	StatusUnhealthy = "unhealthy"
+	StatusStarting  = "starting"
+	StatusDraining  = "draining"
+)
+
+const (
+	defaultCheckTimeout     = 2 * time.Second
+	defaultCheckInterval    = 10 * time.Second
+	defaultFailureThreshold = 3
+	defaultSuccessThreshold = 1
+	defaultFlapWindow       = 2 * time.Minute
+	defaultFlapTransitions  = 4
+)
+
+// Checker reports the health of a single component
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+// CheckerFunc adapts a plain function to a Checker
+type CheckerFunc func(ctx context.Context) error
+
+func (f CheckerFunc) Check(ctx context.Context) error {
+	return f(ctx)
+}
+
+// Check describes a named checker and how its result affects the probes
+type Check struct {
+	Name    string
+	Checker Checker
+	// Critical checks fail the probe; non-critical ones are only reported and degrade the status
+	Critical bool
+	// Liveness checks count toward /livez, everything else toward /readyz
+	Liveness bool
+	// Timeout bounds a single run, defaults to 2s
+	Timeout time.Duration
+	// Interval is how often the check runs in the background, defaults to 10s
+	Interval time.Duration
+	// StaleAfter marks the check failed if it has not completed within this window, defaults to 3 intervals
+	StaleAfter time.Duration
+	// FailureThreshold is how many consecutive failures turn a passing check unhealthy, defaults to 3
+	FailureThreshold int
+	// SuccessThreshold is how many consecutive successes recover a failing check, defaults to 1
+	SuccessThreshold int
+	// A check that changes state FlapTransitions times within FlapWindow is reported as degraded while
+	// it passes, so it does not look fully healthy; while it fails it stays unhealthy. Defaults to
+	// 4 transitions in 2 minutes.
+	FlapWindow      time.Duration
+	FlapTransitions int
+}
+
+func (c Check) timeout() time.Duration {
+	if c.Timeout <= 0 {
+		return defaultCheckTimeout
+	}
+	return c.Timeout
+}
+
+func (c Check) interval() time.Duration {
+	if c.Interval <= 0 {
+		return defaultCheckInterval
+	}
+	return c.Interval
+}
+
+func (c Check) staleAfter() time.Duration {
+	if c.StaleAfter <= 0 {
+		return 3 * c.interval()
+	}
+	return c.StaleAfter
+}
+
+func (c Check) failureThreshold() int {
+	if c.FailureThreshold <= 0 {
+		return defaultFailureThreshold
+	}
+	return c.FailureThreshold
+}
+
+func (c Check) successThreshold() int {
+	if c.SuccessThreshold <= 0 {
+		return defaultSuccessThreshold
+	}
+	return c.SuccessThreshold
+}
+
+func (c Check) flapWindow() time.Duration {
+	if c.FlapWindow <= 0 {
+		return defaultFlapWindow
+	}
+	return c.FlapWindow
+}
+
+func (c Check) flapTransitions() int {
+	if c.FlapTransitions <= 0 {
+		return defaultFlapTransitions
+	}
+	return c.FlapTransitions
+}
+
+// CheckResult is the latest outcome of a check
+type CheckResult struct {
+	Status      string     `json:"status"`
+	Critical    bool       `json:"critical"`
+	Latency     string     `json:"latency"`
+	LastError   string     `json:"last_error,omitempty"`
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+	// ConsecutiveFailures counts failed runs, including those still below the failure threshold
+	ConsecutiveFailures int  `json:"consecutive_failures,omitempty"`
+	Flapping            bool `json:"flapping,omitempty"`
+	// Failing is set while the last runs are past the failure threshold. Unlike Status it ignores
+	// flapping and staleness, so callers can act on the dependency itself.
+	Failing bool `json:"failing,omitempty"`
+}
+
+// Report aggregates the results of a set of checks
+type Report struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+// Healthy reports whether the probe should pass: no critical check failed and the pod is serving
+func (r Report) Healthy() bool {
+	return r.Status == StatusHealthy || r.Status == StatusDegraded
+}
+
+type checkState struct {
+	check Check
+	stop  context.CancelFunc
+
+	mu          sync.Mutex
+	latency     time.Duration
+	lastErr     error
+	lastSuccess time.Time
+	lastChecked time.Time
+
+	// healthy is the state after applying thresholds, failures/successes count consecutive raw results
+	healthy     bool
+	failures    int
+	successes   int
+	transitions []time.Time
+}
+
+// loop runs the check immediately and then on every interval until ctx is cancelled,
+// calling onChange whenever the reported status changes
+func (c *checkState) loop(ctx context.Context, onChange func()) {
+	ticker := time.NewTicker(c.check.interval())
+	defer ticker.Stop()
+
+	for {
+		if c.run(ctx) {
+			onChange()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// run executes the check once and reports whether its reported status changed
+func (c *checkState) run(ctx context.Context) bool {
+	ctx, cancel := context.WithTimeout(ctx, c.check.timeout())
+	defer cancel()
+
+	start := time.Now()
+	err := c.check.Checker.Check(ctx)
+	latency := time.Since(start)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	firstRun := c.lastChecked.IsZero()
+	wasHealthy, wasFlapping := c.healthy, c.isFlapping(now)
+
+	c.latency = latency
+	c.lastErr = err
+	c.lastChecked = now
+	if err == nil {
+		c.lastSuccess = start
+		c.successes++
+		c.failures = 0
+	} else {
+		c.failures++
+		c.successes = 0
+	}
+
+	switch {
+	case firstRun:
+		// Nothing to debounce against yet, take the first result as is
+		c.healthy = err == nil
+	case c.healthy && c.failures >= c.check.failureThreshold():
+		c.healthy = false
+		c.transitions = append(c.transitions, now)
+	case !c.healthy && c.successes >= c.check.successThreshold():
+		c.healthy = true
+		c.transitions = append(c.transitions, now)
+	}
+
+	return firstRun || c.healthy != wasHealthy || c.isFlapping(now) != wasFlapping
+}
+
+// isFlapping prunes transitions outside the window and reports whether too many remain
+func (c *checkState) isFlapping(now time.Time) bool {
+	window := c.check.flapWindow()
+	kept := c.transitions[:0]
+	for _, t := range c.transitions {
+		if now.Sub(t) <= window {
+			kept = append(kept, t)
+		}
+	}
+	c.transitions = kept
+	return len(c.transitions) >= c.check.flapTransitions()
+}
+
+func (c *checkState) result(now time.Time) CheckResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	res := CheckResult{
+		Status:              StatusHealthy,
+		Critical:            c.check.Critical,
+		Latency:             c.latency.String(),
+		ConsecutiveFailures: c.failures,
+		Flapping:            c.isFlapping(now),
+		Failing:             !c.lastChecked.IsZero() && !c.healthy,
+	}
+	if c.lastErr != nil {
+		res.LastError = c.lastErr.Error()
+	}
+	switch {
+	case c.lastChecked.IsZero():
+		res.Status = StatusUnhealthy
+		res.LastError = "check has not completed yet"
+	case now.Sub(c.lastChecked) > c.check.staleAfter():
+		res.Status = StatusUnhealthy
+		res.LastError = fmt.Sprintf("check is stale, last completed %s ago", now.Sub(c.lastChecked).Round(time.Second))
+	case !c.healthy:
+		res.Status = StatusUnhealthy
+	case res.Flapping:
+		res.Status = StatusDegraded
+	}
+	if !c.lastSuccess.IsZero() {
+		lastSuccess := c.lastSuccess
+		res.LastSuccess = &lastSuccess
+	}
+	return res
+}
+
+// Registry holds the checks registered by each component and runs them in the background,
+// so probes are served from cached results instead of hitting dependencies on every request
+type Registry struct {
+	mu      sync.RWMutex
+	checks  []*checkState
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	running bool
+
+	listenersMu sync.RWMutex
+	listeners   []func()
+}
+
+func NewRegistry() *Registry {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Registry{ctx: ctx, cancel: cancel}
+}
+
+// Register adds a check; registering the same name twice replaces the previous check
+func (r *Registry) Register(check Check) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	state := &checkState{check: check}
+	replaced := false
+	for i, existing := range r.checks {
+		if existing.check.Name == check.Name {
+			if existing.stop != nil {
+				existing.stop()
+			}
+			r.checks[i] = state
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		r.checks = append(r.checks, state)
+	}
+	if r.running {
+		r.startCheck(state)
+	}
+}
+
+// Start runs every registered check on its own interval until Stop is called
+func (r *Registry) Start() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.running {
+		return
+	}
+	r.running = true
+	for _, c := range r.checks {
+		r.startCheck(c)
+	}
+}
+
+func (r *Registry) startCheck(c *checkState) {
+	ctx, cancel := context.WithCancel(r.ctx)
+	c.stop = cancel
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		c.loop(ctx, r.notify)
+	}()
+}
+
+// OnChange registers a callback invoked whenever a check starts or stops failing.
+// Callbacks run on the check goroutine and should not block.
+func (r *Registry) OnChange(fn func()) {
+	r.listenersMu.Lock()
+	defer r.listenersMu.Unlock()
+	r.listeners = append(r.listeners, fn)
+}
+
+func (r *Registry) notify() {
+	r.listenersMu.RLock()
+	defer r.listenersMu.RUnlock()
+	for _, fn := range r.listeners {
+		fn()
+	}
+}
+
+// Stop cancels the background checks and waits for in-flight runs to finish
+func (r *Registry) Stop(ctx context.Context) {
+	r.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Println("Health checks shutdown timeout exceeded, forcing stop.")
+	}
+}
+
+// Snapshot returns the cached results of the checks accepted by filter
+func (r *Registry) Snapshot(filter func(Check) bool) Report {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := time.Now()
+	report := Report{Status: StatusHealthy, Checks: make(map[string]CheckResult)}
+	for _, c := range r.checks {
+		if filter != nil && !filter(c.check) {
+			continue
+		}
+		res := c.result(now)
+		report.Checks[c.check.Name] = res
+		switch {
+		case res.Status == StatusHealthy:
+		case res.Status == StatusUnhealthy && res.Critical:
+			report.Status = StatusUnhealthy
+		case report.Status == StatusHealthy:
+			report.Status = StatusDegraded
+		}
+	}
+	return report
+}
+
+// Liveness returns the cached results of the liveness checks
+func (r *Registry) Liveness() Report {
+	return r.Snapshot(func(c Check) bool { return c.Liveness })
+}
+
+// Readiness returns the cached results of the dependency checks
+func (r *Registry) Readiness() Report {
+	return r.Snapshot(func(c Check) bool { return !c.Liveness })
+}
@@ -0,0 +1,145 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+var errDown = errors.New("down")
+
+// scriptedCheck returns a checkState whose checker fails while *failing is set
+func scriptedCheck(check Check, failing *bool) *checkState {
+	check.Checker = CheckerFunc(func(ctx context.Context) error {
+		if *failing {
+			return errDown
+		}
+		return nil
+	})
+	return &checkState{check: check}
+}
+
+func TestCheckStateFailureThreshold(t *testing.T) {
+	failing := false
+	c := scriptedCheck(Check{Name: "db", Critical: true, FailureThreshold: 3}, &failing)
+	ctx := context.Background()
+
+	if !c.run(ctx) {
+		t.Fatal("first run should report a change")
+	}
+	if got := c.result(time.Now()).Status; got != StatusHealthy {
+		t.Fatalf("status after first success = %s, want %s", got, StatusHealthy)
+	}
+
+	failing = true
+	for i := 1; i < 3; i++ {
+		if c.run(ctx) {
+			t.Fatalf("failure %d below the threshold should not report a change", i)
+		}
+		res := c.result(time.Now())
+		if res.Status != StatusHealthy || res.ConsecutiveFailures != i {
+			t.Fatalf("after %d failures got %+v, want healthy with %d consecutive failures", i, res, i)
+		}
+	}
+	if !c.run(ctx) {
+		t.Fatal("failure reaching the threshold should report a change")
+	}
+	if got := c.result(time.Now()).Status; got != StatusUnhealthy {
+		t.Fatalf("status at threshold = %s, want %s", got, StatusUnhealthy)
+	}
+
+	failing = false
+	if !c.run(ctx) {
+		t.Fatal("recovery should report a change")
+	}
+	if res := c.result(time.Now()); res.Status != StatusHealthy || res.ConsecutiveFailures != 0 {
+		t.Fatalf("after recovery got %+v, want healthy without failures", res)
+	}
+}
+
+func TestCheckStateFirstFailureIsUnhealthy(t *testing.T) {
+	failing := true
+	c := scriptedCheck(Check{Name: "db", FailureThreshold: 3}, &failing)
+	c.run(context.Background())
+
+	if got := c.result(time.Now()).Status; got != StatusUnhealthy {
+		t.Fatalf("status after failed first run = %s, want %s", got, StatusUnhealthy)
+	}
+}
+
+func TestCheckStateSuccessThreshold(t *testing.T) {
+	failing := true
+	c := scriptedCheck(Check{Name: "db", FailureThreshold: 1, SuccessThreshold: 2}, &failing)
+	ctx := context.Background()
+	c.run(ctx)
+
+	failing = false
+	c.run(ctx)
+	if got := c.result(time.Now()).Status; got != StatusUnhealthy {
+		t.Fatalf("status after one success = %s, want %s", got, StatusUnhealthy)
+	}
+	c.run(ctx)
+	if got := c.result(time.Now()).Status; got != StatusHealthy {
+		t.Fatalf("status after two successes = %s, want %s", got, StatusHealthy)
+	}
+}
+
+func TestCheckStateFlapping(t *testing.T) {
+	failing := false
+	c := scriptedCheck(Check{Name: "db", Critical: true, FailureThreshold: 1, FlapTransitions: 4}, &failing)
+	ctx := context.Background()
+	c.run(ctx)
+
+	// Four transitions: down, up, down, up
+	for i := 0; i < 4; i++ {
+		failing = !failing
+		c.run(ctx)
+	}
+	res := c.result(time.Now())
+	if !res.Flapping || res.Status != StatusDegraded {
+		t.Fatalf("passing flapping check got %+v, want degraded and flapping", res)
+	}
+
+	failing = true
+	c.run(ctx)
+	res = c.result(time.Now())
+	if !res.Flapping || res.Status != StatusUnhealthy || !res.Failing {
+		t.Fatalf("failing flapping check got %+v, want unhealthy, flapping and failing", res)
+	}
+
+	// Once the window has passed the transitions no longer count
+	later := time.Now().Add(c.check.flapWindow() + time.Second)
+	c.lastChecked = later
+	if res := c.result(later); res.Flapping {
+		t.Fatalf("check still flapping after the window: %+v", res)
+	}
+}
+
+func TestCheckStateStale(t *testing.T) {
+	failing := false
+	c := scriptedCheck(Check{Name: "db", Interval: time.Second}, &failing)
+	c.run(context.Background())
+
+	res := c.result(time.Now().Add(3*time.Second + time.Second))
+	if res.Status != StatusUnhealthy || res.Failing {
+		t.Fatalf("stale check got %+v, want unhealthy but not failing", res)
+	}
+}
+
+func TestSnapshotFailingFlappingCriticalCheck(t *testing.T) {
+	failing := false
+	c := scriptedCheck(Check{Name: "db", Critical: true, FailureThreshold: 1, FlapTransitions: 2}, &failing)
+	ctx := context.Background()
+	c.run(ctx)
+	for i := 0; i < 3; i++ {
+		failing = !failing
+		c.run(ctx)
+	}
+
+	r := &Registry{checks: []*checkState{c}}
+	report := r.Snapshot(nil)
+	if report.Healthy() {
+		t.Fatalf("report with a failing critical check is healthy: %+v", report)
+	}
+}
@@ -15,7 +15,10 @@ func CreateOrderHandler(svc *service.Service) gin.HandlerFunc {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "orderID is required"})
 			return
 		}
-		svc.CreateOrder(orderID)
+		if _, err := svc.CreateOrder(c.Request.Context(), orderID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusOK, gin.H{"message": "Order created", "orderID": orderID})
 	}
 }
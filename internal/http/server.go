@@ -5,26 +5,47 @@ import (
 	"lmwn_gomeetup_failover/internal/service"
 	"log"
 	"net/http"
+	"sync/atomic"
 
 	"github.com/gin-gonic/gin"
 )
 
 type HTTPServer struct {
-	server *http.Server
+	server       *http.Server
+	loadShedding atomic.Bool
 }
 
 func NewHTTPServer(svc *service.Service) *HTTPServer {
+	h := &HTTPServer{}
+
 	r := gin.Default()
-	r.Use(panicRecoveryMiddleware()) // Apply panic recovery middleware
+	r.Use(panicRecoveryMiddleware())               // Apply panic recovery middleware
+	r.Use(loadSheddingMiddleware(&h.loadShedding)) // Reject requests while shedding load
 
 	r.POST("/create-order", CreateOrderHandler(svc))
 
-	srv := &http.Server{
+	h.server = &http.Server{
 		Addr:    ":8080",
 		Handler: r,
 	}
 
-	return &HTTPServer{server: srv}
+	return h
+}
+
+// SetLoadShedding makes the server reject requests with 503 while enabled, e.g. under memory pressure
+func (h *HTTPServer) SetLoadShedding(enabled bool) {
+	h.loadShedding.Store(enabled)
+}
+
+func loadSheddingMiddleware(enabled *atomic.Bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if enabled.Load() {
+			c.Header("Retry-After", "5")
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "Service Unavailable"})
+			return
+		}
+		c.Next()
+	}
 }
 
 func panicRecoveryMiddleware() gin.HandlerFunc {
@@ -0,0 +1,157 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"lmwn_gomeetup_failover/internal/db"
+	"lmwn_gomeetup_failover/internal/router"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	collectionName = "processed_messages"
+
+	// DefaultLease is how long a claim lasts without renewal, router.Idempotency renews it while the handler runs
+	DefaultLease = time.Minute
+	// DefaultRetention is how long processed message IDs are remembered, it should exceed how long duplicates can arrive
+	DefaultRetention = 7 * 24 * time.Hour
+)
+
+const (
+	statusProcessing = "processing"
+	statusProcessed  = "processed"
+)
+
+type record struct {
+	ID          string     `bson:"_id"`
+	Status      string     `bson:"status"`
+	Token       string     `bson:"token,omitempty"`
+	Attempts    int        `bson:"attempts"`
+	LeaseUntil  *time.Time `bson:"lease_until,omitempty"`
+	ProcessedAt *time.Time `bson:"processed_at,omitempty"`
+	// ExpiresAt is when the TTL index removes the record
+	ExpiresAt time.Time `bson:"expires_at"`
+}
+
+// Store is a MongoDB backed router.ProcessedStore keyed by message ID. A claim is a lease:
+// if the handler crashes without completing or releasing it, the message can be claimed again
+// once the lease expires. Every claim gets a new token, and only its holder can renew, complete
+// or release it.
+type Store struct {
+	coll      *mongo.Collection
+	lease     time.Duration
+	retention time.Duration
+}
+
+var _ router.ProcessedStore = (*Store)(nil)
+
+func NewStore(mongo *db.MongoDB, lease, retention time.Duration) *Store {
+	return &Store{
+		coll:      mongo.Collection(collectionName),
+		lease:     lease,
+		retention: retention,
+	}
+}
+
+// EnsureIndexes creates the TTL index that forgets old message IDs
+func (s *Store) EnsureIndexes(ctx context.Context) error {
+	_, err := s.coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	return err
+}
+
+// Claim atomically takes the message: it inserts a processing record, or takes over one whose
+// lease expired. Otherwise it returns router.ErrAlreadyProcessed or router.ErrInProgress.
+func (s *Store) Claim(ctx context.Context, msgID string) (router.Claim, error) {
+	now := time.Now().UTC()
+	claim := router.Claim{Token: uuid.NewString(), LeaseUntil: now.Add(s.lease)}
+	filter := bson.M{
+		"_id":         msgID,
+		"status":      statusProcessing,
+		"lease_until": bson.M{"$lte": now},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"status":      statusProcessing,
+			"token":       claim.Token,
+			"lease_until": claim.LeaseUntil,
+			"expires_at":  now.Add(s.retention),
+		},
+		"$inc": bson.M{"attempts": 1},
+	}
+	// A record that does not match the filter makes the upsert collide on _id
+	_, err := s.coll.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if err == nil {
+		return claim, nil
+	}
+	if !mongo.IsDuplicateKeyError(err) {
+		return router.Claim{}, err
+	}
+
+	var existing record
+	if err := s.coll.FindOne(ctx, bson.M{"_id": msgID}).Decode(&existing); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			// Released or expired in the meantime, let the caller retry
+			return router.Claim{}, router.ErrInProgress
+		}
+		return router.Claim{}, err
+	}
+	if existing.Status == statusProcessed {
+		return router.Claim{}, router.ErrAlreadyProcessed
+	}
+	return router.Claim{}, router.ErrInProgress
+}
+
+// held matches the record of a claim that was not taken over by another handler
+func held(msgID, token string) bson.M {
+	return bson.M{"_id": msgID, "status": statusProcessing, "token": token}
+}
+
+// Renew extends the lease of a claim, or returns router.ErrClaimLost if another handler took it over
+func (s *Store) Renew(ctx context.Context, msgID, token string) (time.Time, error) {
+	leaseUntil := time.Now().UTC().Add(s.lease)
+	res, err := s.coll.UpdateOne(ctx, held(msgID, token), bson.M{"$set": bson.M{"lease_until": leaseUntil}})
+	if err != nil {
+		return time.Time{}, err
+	}
+	if res.MatchedCount == 0 {
+		return time.Time{}, router.ErrClaimLost
+	}
+	return leaseUntil, nil
+}
+
+// Complete marks the message processed and keeps it for the retention period.
+// It returns router.ErrClaimLost if another handler took the claim over.
+func (s *Store) Complete(ctx context.Context, msgID, token string) error {
+	now := time.Now().UTC()
+	res, err := s.coll.UpdateOne(ctx, held(msgID, token), bson.M{
+		"$set": bson.M{
+			"status":       statusProcessed,
+			"processed_at": now,
+			"expires_at":   now.Add(s.retention),
+		},
+		"$unset": bson.M{"lease_until": "", "token": ""},
+	})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return router.ErrClaimLost
+	}
+	return nil
+}
+
+// Release drops an unfinished claim so the message can be processed again right away.
+// A claim taken over by another handler is left alone.
+func (s *Store) Release(ctx context.Context, msgID, token string) error {
+	_, err := s.coll.DeleteOne(ctx, held(msgID, token))
+	return err
+}
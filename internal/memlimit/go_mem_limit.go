@@ -0,0 +1,117 @@
+package memlimit
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"runtime/debug"
+	"time"
+)
+
+const (
+	// DefaultGoMemLimitRatio leaves 10% of the container limit for non-heap memory (stacks, cgo, page cache)
+	DefaultGoMemLimitRatio = 0.9
+	// DefaultGoMemLimitRefreshInterval is how often the container limit is re-read
+	DefaultGoMemLimitRefreshInterval = time.Minute
+)
+
+// SetGoMemLimit sets the Go runtime soft memory limit to ratio of the container memory limit,
+// so the GC works harder before the OOM killer fires. It returns the limit that was applied.
+func SetGoMemLimit(getter MemoryGetter, ratio float64) (int64, error) {
+	if ratio <= 0 || ratio > 1 {
+		return 0, errors.New("ratio must be in range (0, 1]")
+	}
+
+	status, err := ReadMemoryStatus(getter)
+	if err != nil {
+		return 0, err
+	}
+	// Only a cgroup limit belongs to this process: host memory is shared with everything on the
+	// node, and the Go runtime source reports GOMEMLIMIT itself, so it would only shrink
+	if status.Unlimited || !isCgroupSource(status.Source) {
+		return 0, ErrNotSupported
+	}
+
+	limit := int64(float64(status.Limit) * ratio)
+	debug.SetMemoryLimit(limit)
+	return limit, nil
+}
+
+func isCgroupSource(source string) bool {
+	return source == sourceLinuxCgroup || source == sourceLinuxCgroupV2
+}
+
+// GoMemLimitTuner keeps the Go runtime memory limit in sync with the container memory limit
+type GoMemLimitTuner struct {
+	getter   MemoryGetter
+	ratio    float64
+	interval time.Duration
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// NewGoMemLimitTuner creates a tuner that applies ratio of the container limit every interval
+func NewGoMemLimitTuner(getter MemoryGetter, ratio float64, interval time.Duration) *GoMemLimitTuner {
+	return &GoMemLimitTuner{
+		getter:   getter,
+		ratio:    ratio,
+		interval: interval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Start applies the limit once and then refreshes it periodically until Stop is called.
+// It does nothing if GOMEMLIMIT is set explicitly in the environment.
+func (t *GoMemLimitTuner) Start() {
+	defer close(t.done)
+
+	if v, ok := os.LookupEnv("GOMEMLIMIT"); ok {
+		log.Printf("GOMEMLIMIT is set to %s, skipping automatic memory limit tuning", v)
+		return
+	}
+
+	var applied int64
+	apply := func() {
+		limit, err := SetGoMemLimit(t.getter, t.ratio)
+		if errors.Is(err, ErrNotSupported) {
+			return
+		} else if err != nil {
+			log.Printf("Failed to set Go memory limit: %v", err)
+			return
+		}
+		if limit != applied {
+			log.Printf("Go memory limit set to %d bytes (%.0f%% of container limit)", limit, t.ratio*100)
+			applied = limit
+		}
+	}
+
+	apply()
+
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.stop:
+			return
+		case <-ticker.C:
+			apply()
+		}
+	}
+}
+
+// Stop terminates the refresh loop
+func (t *GoMemLimitTuner) Stop(ctx context.Context) {
+	select {
+	case <-t.stop:
+	default:
+		close(t.stop)
+	}
+
+	select {
+	case <-t.done:
+	case <-ctx.Done():
+	}
+}
@@ -0,0 +1,40 @@
+package memlimit
+
+import (
+	"runtime/metrics"
+)
+
+const sourceGoRuntime = "go_runtime"
+
+// goRuntimeMemoryGetter reports memory held by the Go runtime against its soft memory limit.
+// It works on every platform and is the last fallback when no OS-level source is available.
+type goRuntimeMemoryGetter struct{}
+
+func (g *goRuntimeMemoryGetter) Source() string {
+	return sourceGoRuntime
+}
+
+// GetUsedBytes returns memory mapped by the runtime minus heap memory already released to the OS
+func (g *goRuntimeMemoryGetter) GetUsedBytes() (int64, error) {
+	samples := []metrics.Sample{
+		{Name: "/memory/classes/total:bytes"},
+		{Name: "/memory/classes/heap/released:bytes"},
+	}
+	metrics.Read(samples)
+	for _, s := range samples {
+		if s.Value.Kind() != metrics.KindUint64 {
+			return 0, ErrNotSupported
+		}
+	}
+	return int64(samples[0].Value.Uint64() - samples[1].Value.Uint64()), nil
+}
+
+// GetTotalBytes returns the runtime soft memory limit (math.MaxInt64 when GOMEMLIMIT is not set)
+func (g *goRuntimeMemoryGetter) GetTotalBytes() (int64, error) {
+	samples := []metrics.Sample{{Name: "/gc/gomemlimit:bytes"}}
+	metrics.Read(samples)
+	if samples[0].Value.Kind() != metrics.KindUint64 {
+		return 0, ErrNotSupported
+	}
+	return int64(samples[0].Value.Uint64()), nil
+}
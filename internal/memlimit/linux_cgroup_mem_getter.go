@@ -2,7 +2,6 @@ package memlimit
 
 import (
 	"errors"
-	"io"
 	"io/fs"
 	"os"
 	"strconv"
@@ -14,56 +13,48 @@ var (
 	ErrNotSupported = errors.New("not supported")
 )
 
-var checkInitSysFSOnce sync.Once
-
 func (l *linuxCgroupMemoryGetter) checkInitSysFS() {
-	checkInitSysFSOnce.Do(func() {
+	l.initOnce.Do(func() {
 		if l.sysFs == nil {
 			l.sysFs = os.DirFS("/")
 		}
 	})
 }
 
+const sourceLinuxCgroup = "linux_cgroup"
+
+// linuxCgroupMemoryGetter reads the cgroup v1 memory controller
 type linuxCgroupMemoryGetter struct {
-	sysFs fs.FS
+	initOnce sync.Once
+	sysFs    fs.FS
+}
+
+func (l *linuxCgroupMemoryGetter) Source() string {
+	return sourceLinuxCgroup
 }
 
 func (l *linuxCgroupMemoryGetter) GetUsedBytes() (int64, error) {
 	l.checkInitSysFS()
-
-	f, err := l.sysFs.Open("sys/fs/cgroup/memory/memory.usage_in_bytes")
-	if os.IsNotExist(err) {
-		return 0, ErrNotSupported
-	} else if err != nil {
-		return 0, err
-	}
-	b, err := io.ReadAll(f)
-	if err != nil {
-		return 0, err
-	}
-	return parseInt(b)
+	return readInt(l.sysFs, "sys/fs/cgroup/memory/memory.usage_in_bytes")
 }
 
+// GetTotalBytes returns the raw cgroup limit; ReadMemoryStatus detects the "unlimited" sentinel
 func (l *linuxCgroupMemoryGetter) GetTotalBytes() (int64, error) {
 	l.checkInitSysFS()
+	return readInt(l.sysFs, "sys/fs/cgroup/memory/memory.limit_in_bytes")
+}
 
-	f, err := l.sysFs.Open("sys/fs/cgroup/memory/memory.limit_in_bytes")
-	if os.IsNotExist(err) {
+// readInt reads a single integer file, returning ErrNotSupported when it does not exist
+func readInt(fsys fs.FS, name string) (int64, error) {
+	b, err := fs.ReadFile(fsys, name)
+	if errors.Is(err, fs.ErrNotExist) {
 		return 0, ErrNotSupported
 	} else if err != nil {
 		return 0, err
 	}
-	b, err := io.ReadAll(f)
-	if err != nil {
-		return 0, err
-	}
 	return parseInt(b)
 }
 
 func parseInt(b []byte) (int64, error) {
 	return strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
 }
-
-func ProvideMemoryGetter() MemoryGetter {
-	return &linuxCgroupMemoryGetter{}
-}
@@ -0,0 +1,72 @@
+package memlimit
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io/fs"
+	"math"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+const sourceLinuxCgroupV2 = "linux_cgroup_v2"
+
+// linuxCgroupV2MemoryGetter reads the unified (cgroup v2) hierarchy, the default on current
+// Kubernetes nodes. The cgroup of the process is taken from /proc/self/cgroup; inside a container
+// with its own cgroup namespace that is the root of /sys/fs/cgroup.
+type linuxCgroupV2MemoryGetter struct {
+	initOnce sync.Once
+	sysFs    fs.FS
+	dir      string
+}
+
+func (l *linuxCgroupV2MemoryGetter) checkInitSysFS() {
+	l.initOnce.Do(func() {
+		if l.sysFs == nil {
+			l.sysFs = os.DirFS("/")
+		}
+		l.dir = path.Join("sys/fs/cgroup", l.cgroupPath())
+	})
+}
+
+// cgroupPath returns the unified hierarchy path from the "0::<path>" line of /proc/self/cgroup
+func (l *linuxCgroupV2MemoryGetter) cgroupPath() string {
+	b, err := fs.ReadFile(l.sysFs, "proc/self/cgroup")
+	if err != nil {
+		return ""
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		if p, found := strings.CutPrefix(scanner.Text(), "0::"); found {
+			return p
+		}
+	}
+	return ""
+}
+
+func (l *linuxCgroupV2MemoryGetter) Source() string {
+	return sourceLinuxCgroupV2
+}
+
+func (l *linuxCgroupV2MemoryGetter) GetUsedBytes() (int64, error) {
+	l.checkInitSysFS()
+	return readInt(l.sysFs, path.Join(l.dir, "memory.current"))
+}
+
+// GetTotalBytes returns the cgroup limit, or math.MaxInt64 when memory.max is "max" (no limit)
+func (l *linuxCgroupV2MemoryGetter) GetTotalBytes() (int64, error) {
+	l.checkInitSysFS()
+	b, err := fs.ReadFile(l.sysFs, path.Join(l.dir, "memory.max"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, ErrNotSupported
+	} else if err != nil {
+		return 0, err
+	}
+	if strings.TrimSpace(string(b)) == "max" {
+		return math.MaxInt64, nil
+	}
+	return parseInt(b)
+}
@@ -1,49 +1,130 @@
 package memlimit
 
 import (
+	"context"
 	"errors"
+	"log"
+	"os"
+
+	"lmwn_gomeetup_failover/internal/health"
 )
 
 const checkerName = "mem_limit_checker"
 
+// LowMemoryThreshold is the usage percentage above which the process reports itself unhealthy.
+// It sits above DefaultGoMemLimitRatio and the hard pressure level, where the GC and load shedding
+// should hold usage, so only a process that cannot recover fails its liveness probe.
+const LowMemoryThreshold = 95
+
+// lowMemoryFailureThreshold requires usage to stay above the threshold for about a minute
+const lowMemoryFailureThreshold = 6
+
+// unlimitedThreshold treats any limit this large as "no limit". cgroup v1 reports
+// PAGE_COUNTER_MAX (9223372036854771712) and the Go runtime reports math.MaxInt64 when unset.
+const unlimitedThreshold = 1 << 62
+
 var ErrLowMemory = errors.New("low memory")
 
 type MemoryGetter interface {
 	GetUsedBytes() (int64, error)
 	GetTotalBytes() (int64, error)
+	// Source names where the numbers come from, e.g. "linux_cgroup"
+	Source() string
+}
+
+// MemoryStatus is a point-in-time reading of memory usage against the limit, in bytes
+type MemoryStatus struct {
+	Used      int64   `json:"used"`
+	Limit     int64   `json:"limit"`
+	Percent   float64 `json:"percent"`
+	Unlimited bool    `json:"unlimited"`
+	Source    string  `json:"source"`
 }
 
-func IsInLowMemory(getter MemoryGetter, enabledCheck bool, percentageThreshold int) (bool, error) {
-	if !enabledCheck {
-		return false, nil
+// IsLow reports whether usage is at or above percentageThreshold of the limit.
+// A process without a memory limit is never low on memory.
+func (s MemoryStatus) IsLow(percentageThreshold float64) bool {
+	if s.Unlimited {
+		return false
 	}
+	return s.Percent >= percentageThreshold
+}
+
+// ReadMemoryStatus reads usage and limit from getter with byte precision
+func ReadMemoryStatus(getter MemoryGetter) (MemoryStatus, error) {
+	status := MemoryStatus{Source: getter.Source()}
 
-	availableMemory, err := getter.GetTotalBytes()
+	limit, err := getter.GetTotalBytes()
 	if err != nil {
-		if errors.Is(err, ErrNotSupported) {
-			return false, nil
-		}
-		return false, err
+		return status, err
 	}
-	availableMemoryMB := availableMemory / 1024 / 1024
-	lowMemoryThresholdMB := availableMemoryMB * int64(percentageThreshold) / 100
 	used, err := getter.GetUsedBytes()
 	if err != nil {
-		return false, err
+		return status, err
+	}
+
+	status.Used = used
+	status.Limit = limit
+	status.Unlimited = limit <= 0 || limit >= unlimitedThreshold
+	if !status.Unlimited {
+		status.Percent = float64(used) * 100 / float64(limit)
 	}
-	usageMB := used / 1024 / 1024
-	return usageMB >= lowMemoryThresholdMB, nil
+	return status, nil
 }
 
-func LowMemoryHealthAdapter(isLowMemory func() (bool, error)) func() error {
+// ProvideMemoryGetter returns the most specific memory source available: the container cgroup
+// (v2, then v1), then host memory from /proc/meminfo, then the Go runtime itself. A cgroup
+// without a limit is still used, host memory would only describe the whole node.
+func ProvideMemoryGetter() MemoryGetter {
+	rootFs := os.DirFS("/")
+	cgroups := []MemoryGetter{
+		&linuxCgroupV2MemoryGetter{sysFs: rootFs},
+		&linuxCgroupMemoryGetter{sysFs: rootFs},
+	}
+	for _, getter := range cgroups {
+		if _, err := ReadMemoryStatus(getter); err == nil {
+			log.Printf("Using memory source %s", getter.Source())
+			return getter
+		}
+	}
+
+	meminfo := &procMeminfoMemoryGetter{sysFs: rootFs}
+	if status, err := ReadMemoryStatus(meminfo); err == nil && !status.Unlimited {
+		log.Printf("Using memory source %s", meminfo.Source())
+		return meminfo
+	}
+	log.Printf("Using memory source %s", sourceGoRuntime)
+	return &goRuntimeMemoryGetter{}
+}
+
+// LowMemoryHealthAdapter turns a memory reading into a health check returning ErrLowMemory above the threshold
+func LowMemoryHealthAdapter(getter MemoryGetter, percentageThreshold float64) func() error {
 	return func() error {
-		out, err := isLowMemory()
-		if err != nil {
+		status, err := ReadMemoryStatus(getter)
+		if errors.Is(err, ErrNotSupported) {
+			return nil
+		} else if err != nil {
 			return err
 		}
-		if out {
+		if status.IsLow(percentageThreshold) {
 			return ErrLowMemory
 		}
 		return nil
 	}
 }
+
+// RegisterHealthChecks registers low memory as a critical liveness check of the process itself.
+// Keep percentageThreshold above the watcher hard threshold, below it memory pressure is handled by
+// load shedding rather than a restart.
+func RegisterHealthChecks(registry *health.Registry, getter MemoryGetter, percentageThreshold float64) {
+	isLowMemory := LowMemoryHealthAdapter(getter, percentageThreshold)
+	registry.Register(health.Check{
+		Name: checkerName,
+		Checker: health.CheckerFunc(func(ctx context.Context) error {
+			return isLowMemory()
+		}),
+		Critical:         true,
+		Liveness:         true,
+		FailureThreshold: lowMemoryFailureThreshold,
+	})
+}
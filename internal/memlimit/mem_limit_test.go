@@ -0,0 +1,134 @@
+package memlimit
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+)
+
+func TestReadMemoryStatus(t *testing.T) {
+	for _, tt := range []struct {
+		name          string
+		getter        MemoryGetter
+		wantUsed      int64
+		wantLimit     int64
+		wantPercent   float64
+		wantUnlimited bool
+	}{
+		{
+			// Below one megabyte, where rounding to MB used to report 0/0
+			name: "cgroup v1 small limit",
+			getter: &linuxCgroupMemoryGetter{sysFs: fstest.MapFS{
+				"sys/fs/cgroup/memory/memory.usage_in_bytes": {Data: []byte("262144\n")},
+				"sys/fs/cgroup/memory/memory.limit_in_bytes": {Data: []byte("524288\n")},
+			}},
+			wantUsed:    262144,
+			wantLimit:   524288,
+			wantPercent: 50,
+		},
+		{
+			name: "cgroup v1 unlimited",
+			getter: &linuxCgroupMemoryGetter{sysFs: fstest.MapFS{
+				"sys/fs/cgroup/memory/memory.usage_in_bytes": {Data: []byte("1048576\n")},
+				"sys/fs/cgroup/memory/memory.limit_in_bytes": {Data: []byte("9223372036854771712\n")},
+			}},
+			wantUsed:      1048576,
+			wantLimit:     9223372036854771712,
+			wantUnlimited: true,
+		},
+		{
+			name: "cgroup v2 limit",
+			getter: &linuxCgroupV2MemoryGetter{sysFs: fstest.MapFS{
+				"proc/self/cgroup": {Data: []byte("0::/kubepods/pod1/app\n")},
+				"sys/fs/cgroup/kubepods/pod1/app/memory.current": {Data: []byte("750\n")},
+				"sys/fs/cgroup/kubepods/pod1/app/memory.max":     {Data: []byte("1000\n")},
+			}},
+			wantUsed:    750,
+			wantLimit:   1000,
+			wantPercent: 75,
+		},
+		{
+			name: "cgroup v2 max",
+			getter: &linuxCgroupV2MemoryGetter{sysFs: fstest.MapFS{
+				"proc/self/cgroup":             {Data: []byte("0::/\n")},
+				"sys/fs/cgroup/memory.current": {Data: []byte("4096\n")},
+				"sys/fs/cgroup/memory.max":     {Data: []byte("max\n")},
+			}},
+			wantUsed:      4096,
+			wantLimit:     9223372036854775807,
+			wantUnlimited: true,
+		},
+		{
+			name: "proc meminfo",
+			getter: &procMeminfoMemoryGetter{sysFs: fstest.MapFS{
+				"proc/meminfo": {Data: []byte("MemTotal:       16384 kB\nMemFree:         1024 kB\nMemAvailable:    4096 kB\nHugePages_Total:       0\n")},
+			}},
+			wantUsed:    12288 * 1024,
+			wantLimit:   16384 * 1024,
+			wantPercent: 75,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			status, err := ReadMemoryStatus(tt.getter)
+			if err != nil {
+				t.Fatalf("ReadMemoryStatus() error = %v", err)
+			}
+			if status.Used != tt.wantUsed || status.Limit != tt.wantLimit || status.Percent != tt.wantPercent || status.Unlimited != tt.wantUnlimited {
+				t.Fatalf("ReadMemoryStatus() = %+v, want used=%d limit=%d percent=%v unlimited=%v",
+					status, tt.wantUsed, tt.wantLimit, tt.wantPercent, tt.wantUnlimited)
+			}
+			if status.Unlimited && status.IsLow(0) {
+				t.Fatal("unlimited status reported as low on memory")
+			}
+		})
+	}
+}
+
+func TestReadMemoryStatusMissingFiles(t *testing.T) {
+	for _, getter := range []MemoryGetter{
+		&linuxCgroupMemoryGetter{sysFs: fstest.MapFS{}},
+		&linuxCgroupV2MemoryGetter{sysFs: fstest.MapFS{}},
+		&procMeminfoMemoryGetter{sysFs: fstest.MapFS{}},
+		&procMeminfoMemoryGetter{sysFs: fstest.MapFS{"proc/meminfo": {Data: []byte("MemTotal: 1024 kB\n")}}},
+	} {
+		if _, err := ReadMemoryStatus(getter); !errors.Is(err, ErrNotSupported) {
+			t.Errorf("%s: error = %v, want ErrNotSupported", getter.Source(), err)
+		}
+	}
+}
+
+func TestWatcherNextLevel(t *testing.T) {
+	w := NewWatcher(nil, WatcherConfig{SoftThreshold: 80, HardThreshold: 90, Hysteresis: 5})
+
+	steps := []struct {
+		percent float64
+		want    PressureLevel
+	}{
+		{50, PressureNone},
+		{80, PressureSoft},
+		{76, PressureSoft}, // within the hysteresis below soft
+		{75, PressureNone},
+		{95, PressureHard},
+		{86, PressureHard}, // within the hysteresis below hard
+		{85, PressureSoft},
+		{90, PressureHard},
+		{60, PressureNone},
+	}
+	level := PressureNone
+	for _, step := range steps {
+		next := w.nextLevel(level, step.percent)
+		if next != step.want {
+			t.Fatalf("nextLevel(%s, %v) = %s, want %s", level, step.percent, next, step.want)
+		}
+		level = next
+	}
+}
+
+func TestSetGoMemLimitRequiresCgroup(t *testing.T) {
+	meminfo := &procMeminfoMemoryGetter{sysFs: fstest.MapFS{
+		"proc/meminfo": {Data: []byte("MemTotal: 16384 kB\nMemAvailable: 4096 kB\n")},
+	}}
+	if _, err := SetGoMemLimit(meminfo, DefaultGoMemLimitRatio); !errors.Is(err, ErrNotSupported) {
+		t.Fatalf("SetGoMemLimit(host memory) error = %v, want ErrNotSupported", err)
+	}
+}
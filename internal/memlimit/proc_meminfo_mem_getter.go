@@ -0,0 +1,86 @@
+package memlimit
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+)
+
+const sourceProcMeminfo = "proc_meminfo"
+
+// procMeminfoMemoryGetter reports host-level memory from /proc/meminfo.
+// It is used when the process does not run inside a memory-limited cgroup.
+type procMeminfoMemoryGetter struct {
+	sysFs fs.FS
+}
+
+func (p *procMeminfoMemoryGetter) Source() string {
+	return sourceProcMeminfo
+}
+
+func (p *procMeminfoMemoryGetter) GetUsedBytes() (int64, error) {
+	info, err := p.readMeminfo()
+	if err != nil {
+		return 0, err
+	}
+	total, ok := info["MemTotal"]
+	if !ok {
+		return 0, ErrNotSupported
+	}
+	available, ok := info["MemAvailable"]
+	if !ok {
+		return 0, ErrNotSupported
+	}
+	return total - available, nil
+}
+
+func (p *procMeminfoMemoryGetter) GetTotalBytes() (int64, error) {
+	info, err := p.readMeminfo()
+	if err != nil {
+		return 0, err
+	}
+	total, ok := info["MemTotal"]
+	if !ok {
+		return 0, ErrNotSupported
+	}
+	return total, nil
+}
+
+// readMeminfo parses /proc/meminfo into bytes keyed by field name
+func (p *procMeminfoMemoryGetter) readMeminfo() (map[string]int64, error) {
+	b, err := fs.ReadFile(p.sysFs, "proc/meminfo")
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotSupported
+	} else if err != nil {
+		return nil, err
+	}
+
+	info := make(map[string]int64)
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		// e.g. "MemTotal:       16384000 kB"
+		key, value, found := strings.Cut(scanner.Text(), ":")
+		if !found {
+			continue
+		}
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
+			continue
+		}
+		n, err := parseInt([]byte(fields[0]))
+		if err != nil {
+			return nil, fmt.Errorf("parse %s in /proc/meminfo: %w", key, err)
+		}
+		if len(fields) > 1 && fields[1] == "kB" {
+			n *= 1024
+		}
+		info[key] = n
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
@@ -0,0 +1,176 @@
+package memlimit
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// PressureLevel describes how close the process is to its memory limit
+type PressureLevel int
+
+const (
+	PressureNone PressureLevel = iota
+	PressureSoft
+	PressureHard
+)
+
+func (l PressureLevel) String() string {
+	switch l {
+	case PressureNone:
+		return "none"
+	case PressureSoft:
+		return "soft"
+	case PressureHard:
+		return "hard"
+	default:
+		return "unknown"
+	}
+}
+
+// PressureEvent is emitted whenever the pressure level changes
+type PressureEvent struct {
+	Level    PressureLevel
+	Previous PressureLevel
+	Status   MemoryStatus
+}
+
+// WatcherConfig configures the memory pressure watcher. Thresholds are percentages of the memory limit.
+type WatcherConfig struct {
+	Interval      time.Duration
+	SoftThreshold float64
+	HardThreshold float64
+	// Hysteresis is how many percentage points usage must drop below a threshold before the level is lowered
+	Hysteresis float64
+}
+
+// DefaultWatcherConfig returns the thresholds used by the cmd binaries
+func DefaultWatcherConfig() WatcherConfig {
+	return WatcherConfig{
+		Interval:      5 * time.Second,
+		SoftThreshold: 80,
+		HardThreshold: 90,
+		Hysteresis:    5,
+	}
+}
+
+// Watcher polls a MemoryGetter in the background and notifies listeners when the pressure level changes
+type Watcher struct {
+	getter MemoryGetter
+	cfg    WatcherConfig
+
+	mu        sync.RWMutex
+	level     PressureLevel
+	listeners []func(PressureEvent)
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewWatcher creates a watcher; call Start to begin polling
+func NewWatcher(getter MemoryGetter, cfg WatcherConfig) *Watcher {
+	return &Watcher{
+		getter: getter,
+		cfg:    cfg,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+// OnChange registers a callback invoked on every level transition.
+// Callbacks run on the watcher goroutine and should not block.
+func (w *Watcher) OnChange(fn func(PressureEvent)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.listeners = append(w.listeners, fn)
+}
+
+// Level returns the current pressure level
+func (w *Watcher) Level() PressureLevel {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.level
+}
+
+// Start polls memory usage until Stop is called
+func (w *Watcher) Start() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		w.poll()
+
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Stop terminates the polling loop
+func (w *Watcher) Stop(ctx context.Context) {
+	select {
+	case <-w.stop:
+	default:
+		close(w.stop)
+	}
+
+	select {
+	case <-w.done:
+	case <-ctx.Done():
+	}
+}
+
+func (w *Watcher) poll() {
+	status, err := ReadMemoryStatus(w.getter)
+	if errors.Is(err, ErrNotSupported) {
+		return
+	} else if err != nil {
+		log.Printf("Memory watcher failed to read memory status: %v", err)
+		return
+	}
+	percent := status.Percent
+
+	w.mu.Lock()
+	previous := w.level
+	next := w.nextLevel(previous, percent)
+	w.level = next
+	listeners := append([]func(PressureEvent){}, w.listeners...)
+	w.mu.Unlock()
+
+	if next == previous {
+		return
+	}
+
+	log.Printf("Memory pressure changed from %s to %s (%.1f%% used)", previous, next, percent)
+	event := PressureEvent{
+		Level:    next,
+		Previous: previous,
+		Status:   status,
+	}
+	for _, fn := range listeners {
+		fn(event)
+	}
+}
+
+// nextLevel raises the level as soon as a threshold is crossed,
+// but only lowers it once usage drops below the threshold minus the hysteresis
+func (w *Watcher) nextLevel(current PressureLevel, percent float64) PressureLevel {
+	switch {
+	case percent >= w.cfg.HardThreshold:
+		return PressureHard
+	case current == PressureHard && percent > w.cfg.HardThreshold-w.cfg.Hysteresis:
+		return PressureHard
+	case percent >= w.cfg.SoftThreshold:
+		return PressureSoft
+	case current >= PressureSoft && percent > w.cfg.SoftThreshold-w.cfg.Hysteresis:
+		return PressureSoft
+	default:
+		return PressureNone
+	}
+}
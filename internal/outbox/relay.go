@@ -0,0 +1,160 @@
+package outbox
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// PublishFunc publishes a message and returns once the broker confirmed it, e.g. queue.RabbitMQ.PublishWithConfirm
+type PublishFunc func(ctx context.Context, routingKey, msgID, eventName string, payload []byte, ref map[string]string) error
+
+// RelayConfig configures the outbox relay
+type RelayConfig struct {
+	// Interval is how often the outbox is polled when Notify is not called
+	Interval time.Duration
+	// BatchSize caps how many messages are published per poll
+	BatchSize int
+	// Lease is how long a claimed message is hidden from other relays while it is being published
+	Lease time.Duration
+	// PublishTimeout bounds a single publish including the broker confirm
+	PublishTimeout time.Duration
+	// MinBackoff and MaxBackoff bound the exponential delay before a failed message is retried
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+func DefaultRelayConfig() RelayConfig {
+	return RelayConfig{
+		Interval:       time.Second,
+		BatchSize:      100,
+		Lease:          30 * time.Second,
+		PublishTimeout: 5 * time.Second,
+		MinBackoff:     time.Second,
+		MaxBackoff:     5 * time.Minute,
+	}
+}
+
+// Relay publishes pending outbox messages and marks them sent once the broker confirmed them.
+// Failed messages stay pending and are retried with backoff, so delivery is at least once.
+type Relay struct {
+	store   *Store
+	publish PublishFunc
+	cfg     RelayConfig
+
+	wake chan struct{}
+	stop chan struct{}
+	done chan struct{}
+}
+
+func NewRelay(store *Store, publish PublishFunc, cfg RelayConfig) *Relay {
+	return &Relay{
+		store:   store,
+		publish: publish,
+		cfg:     cfg,
+		wake:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// Notify asks the relay to poll right away, e.g. after a transaction that added a message committed
+func (r *Relay) Notify() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Start polls the outbox until Stop is called
+func (r *Relay) Start() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		r.relay()
+
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+		case <-r.wake:
+		}
+	}
+}
+
+// Stop terminates the polling loop, messages not yet published are picked up on the next start
+func (r *Relay) Stop(ctx context.Context) {
+	log.Println("Stopping outbox relay...")
+	select {
+	case <-r.stop:
+	default:
+		close(r.stop)
+	}
+
+	select {
+	case <-r.done:
+		log.Println("Outbox relay stopped.")
+	case <-ctx.Done():
+		log.Println("Outbox relay shutdown timeout exceeded, forcing stop.")
+	}
+}
+
+// relay publishes up to one batch of due messages
+func (r *Relay) relay() {
+	for i := 0; i < r.cfg.BatchSize; i++ {
+		select {
+		case <-r.stop:
+			return
+		default:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), r.cfg.PublishTimeout)
+		msg, err := r.store.claim(ctx, r.cfg.Lease)
+		if err != nil {
+			cancel()
+			log.Printf("Outbox relay failed to claim message: %v", err)
+			return
+		}
+		if msg == nil {
+			cancel()
+			return
+		}
+
+		err = r.publish(ctx, msg.RoutingKey, msg.ID, msg.EventType, msg.Payload, msg.Headers)
+		cancel()
+		r.complete(msg, err)
+	}
+}
+
+// complete records the publish outcome; if that fails the lease expires and the message is published again
+func (r *Relay) complete(msg *Message, publishErr error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.cfg.PublishTimeout)
+	defer cancel()
+
+	if publishErr == nil {
+		if err := r.store.markSent(ctx, msg.ID); err != nil {
+			log.Printf("Outbox relay failed to mark message %s sent: %v", msg.ID, err)
+		}
+		return
+	}
+
+	retryIn := r.backoff(msg.Attempts)
+	log.Printf("Outbox relay failed to publish message %s (attempt %d), retrying in %v: %v", msg.ID, msg.Attempts, retryIn, publishErr)
+	if err := r.store.markFailed(ctx, msg.ID, publishErr, time.Now().Add(retryIn)); err != nil {
+		log.Printf("Outbox relay failed to reschedule message %s: %v", msg.ID, err)
+	}
+}
+
+func (r *Relay) backoff(attempts int) time.Duration {
+	delay := r.cfg.MinBackoff
+	for i := 1; i < attempts && delay < r.cfg.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > r.cfg.MaxBackoff {
+		delay = r.cfg.MaxBackoff
+	}
+	return delay
+}
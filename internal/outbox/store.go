@@ -0,0 +1,126 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"lmwn_gomeetup_failover/internal/db"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	collectionName = "outbox"
+	// sentRetention is how long sent messages are kept before the TTL index removes them
+	sentRetention = 7 * 24 * time.Hour
+)
+
+const (
+	StatusPending = "pending"
+	StatusSent    = "sent"
+)
+
+// Message is an event waiting in the outbox to be published
+type Message struct {
+	ID         string            `bson:"_id"`
+	RoutingKey string            `bson:"routing_key"`
+	EventType  string            `bson:"event_type"`
+	Payload    []byte            `bson:"payload"`
+	Headers    map[string]string `bson:"headers,omitempty"`
+	Status     string            `bson:"status"`
+	Attempts   int               `bson:"attempts"`
+	LastError  string            `bson:"last_error,omitempty"`
+	CreatedAt  time.Time         `bson:"created_at"`
+	// NextAttemptAt is when the relay may pick the message up, it is pushed forward while publishing and after failures
+	NextAttemptAt time.Time  `bson:"next_attempt_at"`
+	SentAt        *time.Time `bson:"sent_at,omitempty"`
+}
+
+// NewMessage creates a pending message; id becomes the message ID on the queue
+func NewMessage(id, routingKey, eventType string, payload []byte, headers map[string]string) Message {
+	now := time.Now().UTC()
+	return Message{
+		ID:            id,
+		RoutingKey:    routingKey,
+		EventType:     eventType,
+		Payload:       payload,
+		Headers:       headers,
+		Status:        StatusPending,
+		CreatedAt:     now,
+		NextAttemptAt: now,
+	}
+}
+
+// Store keeps outbox messages in MongoDB
+type Store struct {
+	coll *mongo.Collection
+}
+
+func NewStore(mongo *db.MongoDB) *Store {
+	return &Store{coll: mongo.Collection(collectionName)}
+}
+
+// EnsureIndexes creates the index the relay polls on and the TTL index that cleans up sent messages
+func (s *Store) EnsureIndexes(ctx context.Context) error {
+	_, err := s.coll.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}}},
+		{
+			Keys:    bson.D{{Key: "sent_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(sentRetention.Seconds())),
+		},
+	})
+	return err
+}
+
+// Add inserts a message. Pass the ctx of a db.MongoDB.WithTransaction callback so the
+// message is only stored if the business data it describes is stored as well.
+func (s *Store) Add(ctx context.Context, msg Message) error {
+	_, err := s.coll.InsertOne(ctx, msg)
+	return err
+}
+
+// claim picks the oldest due message and hides it from other relays for the lease duration.
+// If the relay dies before marking it, the message becomes due again once the lease expires.
+func (s *Store) claim(ctx context.Context, lease time.Duration) (*Message, error) {
+	now := time.Now().UTC()
+	filter := bson.M{
+		"status":          StatusPending,
+		"next_attempt_at": bson.M{"$lte": now},
+	}
+	update := bson.M{
+		"$set": bson.M{"next_attempt_at": now.Add(lease)},
+		"$inc": bson.M{"attempts": 1},
+	}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "next_attempt_at", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var msg Message
+	err := s.coll.FindOneAndUpdate(ctx, filter, update, opts).Decode(&msg)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+func (s *Store) markSent(ctx context.Context, id string) error {
+	now := time.Now().UTC()
+	_, err := s.coll.UpdateByID(ctx, id, bson.M{
+		"$set":   bson.M{"status": StatusSent, "sent_at": now},
+		"$unset": bson.M{"last_error": ""},
+	})
+	return err
+}
+
+func (s *Store) markFailed(ctx context.Context, id string, cause error, retryAt time.Time) error {
+	_, err := s.coll.UpdateByID(ctx, id, bson.M{
+		"$set": bson.M{"last_error": cause.Error(), "next_attempt_at": retryAt.UTC()},
+	})
+	return err
+}
@@ -0,0 +1,352 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"runtime/debug"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"lmwn_gomeetup_failover/internal/health"
+)
+
+// Handler processes one message. A nil error acks the message, an error schedules it for retry,
+// see ErrRequeue and ErrDeadLetter for the other outcomes.
+type Handler func(ctx context.Context, m Message) error
+
+// RunnerOptions configures a consumer runner
+type RunnerOptions struct {
+	// Concurrency is the number of parallel handlers, defaults to the consumer prefetch count
+	Concurrency int
+	// OrderingKey, when set, sends deliveries with the same key to the same handler so they are processed in order
+	OrderingKey func(m Message) string
+}
+
+// HeaderKey returns an OrderingKey that reads a string header, e.g. the order ID
+func HeaderKey(name string) func(m Message) string {
+	return func(m Message) string {
+		v, _ := m.Headers[name].(string)
+		return v
+	}
+}
+
+// Runner consumes a queue with bounded parallelism and acks or retries every delivery.
+// While paused it cancels its subscription, so the broker hands messages to other consumers.
+type Runner struct {
+	broker   Consumer
+	consumer ConsumerOptions
+	opts     RunnerOptions
+	handler  Handler
+
+	mu           sync.Mutex
+	pauseReasons map[string]struct{}
+	// changed is signalled whenever the pause reasons change
+	changed chan struct{}
+
+	cancelConsume  context.CancelFunc
+	cancelHandlers context.CancelFunc
+	done           chan struct{}
+}
+
+func NewRunner(broker Consumer, consumer ConsumerOptions, opts RunnerOptions, handler Handler) *Runner {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = consumer.PrefetchCount
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 1
+	}
+	return &Runner{
+		broker:       broker,
+		consumer:     consumer,
+		opts:         opts,
+		handler:      handler,
+		pauseReasons: make(map[string]struct{}),
+		changed:      make(chan struct{}, 1),
+		done:         make(chan struct{}),
+	}
+}
+
+// Start starts the handlers and subscribes to the queue, unless the runner is already paused
+func (r *Runner) Start() error {
+	consumeCtx, cancelConsume := context.WithCancel(context.Background())
+
+	var deliveries <-chan Message
+	var cancelSub context.CancelFunc
+	if !r.isPaused() {
+		var err error
+		deliveries, cancelSub, err = r.subscribe(consumeCtx)
+		if err != nil {
+			cancelConsume()
+			return err
+		}
+	}
+
+	// Handlers get their own context so in-flight messages can finish after consuming stops
+	handlerCtx, cancelHandlers := context.WithCancel(context.Background())
+	r.cancelConsume = cancelConsume
+	r.cancelHandlers = cancelHandlers
+
+	// Without an ordering key all handlers share one queue, otherwise each handler owns a queue.
+	// Owned queues are buffered up to the prefetch count, so a slow key does not stop the
+	// dispatcher from feeding the other handlers.
+	workerQueues := make([]chan Message, r.opts.Concurrency)
+	shared := make(chan Message)
+	for i := range workerQueues {
+		if r.opts.OrderingKey == nil {
+			workerQueues[i] = shared
+		} else {
+			workerQueues[i] = make(chan Message, r.consumer.PrefetchCount)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i := range workerQueues {
+		wg.Add(1)
+		go func(in <-chan Message) {
+			defer wg.Done()
+			for m := range in {
+				r.handle(handlerCtx, m)
+			}
+		}(workerQueues[i])
+	}
+
+	go func() {
+		defer close(r.done)
+		r.run(consumeCtx, deliveries, cancelSub, workerQueues)
+		if r.opts.OrderingKey == nil {
+			close(shared)
+		} else {
+			for _, q := range workerQueues {
+				close(q)
+			}
+		}
+		wg.Wait()
+	}()
+
+	log.Printf("Consumer started with %d handlers", r.opts.Concurrency)
+	return nil
+}
+
+// run dispatches deliveries until ctx is cancelled, dropping the subscription while paused
+// and subscribing again once resumed
+func (r *Runner) run(ctx context.Context, deliveries <-chan Message, cancelSub context.CancelFunc, workerQueues []chan Message) {
+	for {
+		if deliveries != nil {
+			r.dispatch(deliveries, cancelSub, workerQueues)
+			cancelSub()
+			deliveries = nil
+		}
+
+		for r.isPaused() {
+			select {
+			case <-ctx.Done():
+				return
+			case <-r.changed:
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		var err error
+		deliveries, cancelSub, err = r.subscribe(ctx)
+		if errors.Is(err, ErrStopped) {
+			return
+		}
+		if err != nil {
+			log.Printf("Consumer failed to subscribe: %v", err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-r.changed:
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+		log.Println("Consumer resumed")
+	}
+}
+
+func (r *Runner) subscribe(ctx context.Context) (<-chan Message, context.CancelFunc, error) {
+	subCtx, cancel := context.WithCancel(ctx)
+	deliveries, err := r.broker.GetConsumerChannel(subCtx, r.consumer)
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+	return deliveries, cancel, nil
+}
+
+// dispatch hands deliveries to the handlers until the delivery channel closes. Pausing cancels
+// the subscription; deliveries already prefetched are requeued by the broker implementation.
+func (r *Runner) dispatch(deliveries <-chan Message, cancelSub context.CancelFunc, workerQueues []chan Message) {
+	for {
+		select {
+		case <-r.changed:
+			if r.isPaused() {
+				log.Printf("Consumer paused: %s", strings.Join(r.PauseReasons(), ", "))
+				cancelSub()
+			}
+		case m, ok := <-deliveries:
+			if !ok {
+				return
+			}
+			workerQueues[r.workerFor(m)] <- m
+		}
+	}
+}
+
+func (r *Runner) workerFor(m Message) int {
+	if r.opts.OrderingKey == nil {
+		return 0
+	}
+	h := fnv.New32a()
+	h.Write([]byte(r.opts.OrderingKey(m)))
+	return int(h.Sum32() % uint32(r.opts.Concurrency))
+}
+
+// handle runs the handler and settles the delivery: ack on success, requeue, park or redeliver when
+// the error wraps ErrRequeue, ErrDeadLetter or ErrRetryLater, and retry later on any other error
+func (r *Runner) handle(ctx context.Context, m Message) {
+	err := r.safeHandle(ctx, m)
+	switch {
+	case err == nil:
+		if err := m.Ack(); err != nil {
+			log.Printf("Failed to ack message %s: %v", m.ID, err)
+		}
+	case errors.Is(err, ErrRequeue):
+		if err := m.Nack(true); err != nil {
+			log.Printf("Failed to requeue message %s: %v", m.ID, err)
+		}
+	case errors.Is(err, ErrRetryLater):
+		if err := r.broker.RetryLater(m, err); err != nil {
+			log.Printf("Failed to schedule redelivery: %v", err)
+		}
+	case errors.Is(err, ErrDeadLetter):
+		log.Printf("Dead lettering message %s: %v", m.ID, err)
+		if err := r.broker.Park(m, err); err != nil {
+			log.Printf("Failed to park message: %v", err)
+		}
+	default:
+		log.Printf("Error processing message %s: %v", m.ID, err)
+		// Retry later instead of requeueing straight away, poison messages end up parked
+		if err := r.broker.Retry(m, err); err != nil {
+			log.Printf("Failed to schedule retry: %v", err)
+		}
+	}
+}
+
+// safeHandle turns a handler panic into an error so the message is retried instead of lost
+func (r *Runner) safeHandle(ctx context.Context, m Message) (err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			log.Printf("Recovered from panic in consumer: %v\nStack Trace: %s", rec, debug.Stack())
+			err = fmt.Errorf("handler panic: %v", rec)
+		}
+	}()
+	return r.handler(ctx, m)
+}
+
+// Pause cancels the subscription until every reason it was paused for is resumed,
+// e.g. Pause("memory_pressure"). In-flight messages still finish.
+func (r *Runner) Pause(reason string) {
+	r.mu.Lock()
+	_, exists := r.pauseReasons[reason]
+	r.pauseReasons[reason] = struct{}{}
+	r.mu.Unlock()
+	if !exists {
+		r.notify()
+	}
+}
+
+// Resume clears a pause reason and subscribes again once no other reason is left
+func (r *Runner) Resume(reason string) {
+	r.mu.Lock()
+	_, exists := r.pauseReasons[reason]
+	delete(r.pauseReasons, reason)
+	r.mu.Unlock()
+	if exists {
+		r.notify()
+	}
+}
+
+func (r *Runner) notify() {
+	select {
+	case r.changed <- struct{}{}:
+	default:
+	}
+}
+
+func (r *Runner) isPaused() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.pauseReasons) > 0
+}
+
+// PauseReasons returns why the runner is paused, empty while it is consuming
+func (r *Runner) PauseReasons() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	reasons := make([]string, 0, len(r.pauseReasons))
+	for reason := range r.pauseReasons {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	return reasons
+}
+
+// PauseOnFailingChecks pauses the runner while any of the named health checks fails and resumes
+// it once they pass again, e.g. so messages are not pulled and retried while MongoDB is down.
+// The decision follows the check's own failure state, so a flapping check still pauses the runner
+// while it fails. Checks that have not completed a run yet do not pause the runner.
+func (r *Runner) PauseOnFailingChecks(registry *health.Registry, names ...string) {
+	registry.OnChange(func() {
+		report := registry.Snapshot(func(c health.Check) bool { return slices.Contains(names, c.Name) })
+		for _, name := range names {
+			res, ok := report.Checks[name]
+			if ok && res.Failing {
+				r.Pause(name)
+			} else {
+				r.Resume(name)
+			}
+		}
+	})
+}
+
+// RegisterHealthChecks reports the runner as a non-critical check that fails while it is paused,
+// so the pause reasons show up in the health output
+func (r *Runner) RegisterHealthChecks(registry *health.Registry) {
+	registry.Register(health.Check{
+		Name: "consumer",
+		Checker: health.CheckerFunc(func(ctx context.Context) error {
+			if reasons := r.PauseReasons(); len(reasons) > 0 {
+				return fmt.Errorf("consumer paused: %s", strings.Join(reasons, ", "))
+			}
+			return nil
+		}),
+		Interval:         time.Second,
+		FailureThreshold: 1,
+	})
+}
+
+// Stop cancels the subscription and waits for in-flight messages to finish.
+// Handlers still running when ctx expires have their context cancelled.
+func (r *Runner) Stop(ctx context.Context) {
+	log.Println("Stopping consumer...")
+	r.cancelConsume()
+
+	select {
+	case <-r.done:
+		r.cancelHandlers()
+		log.Println("Consumer stopped, all in-flight messages finished.")
+	case <-ctx.Done():
+		r.cancelHandlers()
+		log.Println("Consumer shutdown timeout exceeded, cancelling in-flight messages.")
+	}
+}
@@ -0,0 +1,183 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// startRunner runs handler against a fresh in-memory broker and stops both when the test ends
+func startRunner(t *testing.T, opts RunnerOptions, handler Handler) (*Memory, *Runner) {
+	t.Helper()
+	broker := NewMemory(100, RetryPolicy{MaxAttempts: 3, Delay: 10 * time.Millisecond})
+	runner := NewRunner(broker, ConsumerOptions{PrefetchCount: 4}, opts, handler)
+	if err := runner.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		runner.Stop(ctx)
+		broker.Stop(ctx)
+	})
+	return broker, runner
+}
+
+func publish(t *testing.T, broker *Memory, id string, ref map[string]string) {
+	t.Helper()
+	if err := broker.PublishWithConfirm(context.Background(), "order.created", id, "order.created", []byte("{}"), ref); err != nil {
+		t.Fatalf("PublishWithConfirm(%s) error = %v", id, err)
+	}
+}
+
+// eventually polls cond until it holds or a second has passed
+func eventually(t *testing.T, cond func() bool, msg string) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal(msg)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// attempts counts handler calls per message ID
+type attempts struct {
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+func (a *attempts) add(id string) int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.calls == nil {
+		a.calls = make(map[string]int)
+	}
+	a.calls[id]++
+	return a.calls[id]
+}
+
+func (a *attempts) get(id string) int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.calls[id]
+}
+
+func TestRunnerRetriesThenParks(t *testing.T) {
+	var calls attempts
+	errFailed := errors.New("failed")
+	broker, _ := startRunner(t, RunnerOptions{}, func(ctx context.Context, m Message) error {
+		calls.add(m.ID)
+		return errFailed
+	})
+	publish(t, broker, "m1", nil)
+
+	eventually(t, func() bool { return len(broker.Parked()) == 1 }, "message was not parked")
+	if got := calls.get("m1"); got != 3 {
+		t.Fatalf("handler called %d times, want MaxAttempts (3)", got)
+	}
+	parked := broker.Parked()[0]
+	if RetryCount(parked) != 3 || parked.Headers[failureReasonHeader] != errFailed.Error() {
+		t.Fatalf("parked headers = %v, want retry count 3 and the failure reason", parked.Headers)
+	}
+}
+
+func TestRunnerOutcomes(t *testing.T) {
+	var calls attempts
+	broker, _ := startRunner(t, RunnerOptions{}, func(ctx context.Context, m Message) error {
+		n := calls.add(m.ID)
+		switch m.ID {
+		case "dead":
+			return fmt.Errorf("%w: cannot decode", ErrDeadLetter)
+		case "later":
+			// More redeliveries than MaxAttempts, none of them counted as a failure
+			if n <= 5 {
+				return ErrRetryLater
+			}
+		case "requeue":
+			if n == 1 {
+				return ErrRequeue
+			}
+			if !m.Redelivered {
+				return errors.New("requeued message not marked redelivered")
+			}
+		case "panic":
+			if n == 1 {
+				panic("boom")
+			}
+		}
+		return nil
+	})
+	for _, id := range []string{"ok", "dead", "later", "requeue", "panic"} {
+		publish(t, broker, id, nil)
+	}
+
+	eventually(t, func() bool {
+		return calls.get("ok") == 1 && calls.get("later") == 6 && calls.get("requeue") == 2 && calls.get("panic") == 2
+	}, "messages were not handled as expected")
+	parked := broker.Parked()
+	if len(parked) != 1 || parked[0].ID != "dead" {
+		t.Fatalf("parked = %v, want only the dead lettered message", parked)
+	}
+	if got := calls.get("dead"); got != 1 {
+		t.Fatalf("dead lettered message handled %d times, want 1", got)
+	}
+}
+
+func TestRunnerKeepsKeyOrder(t *testing.T) {
+	var mu sync.Mutex
+	seen := make(map[string][]int)
+	broker, _ := startRunner(t, RunnerOptions{Concurrency: 4, OrderingKey: HeaderKey("order_id")}, func(ctx context.Context, m Message) error {
+		var seq int
+		fmt.Sscanf(m.Headers["seq"].(string), "%d", &seq)
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		defer mu.Unlock()
+		key := m.Headers["order_id"].(string)
+		seen[key] = append(seen[key], seq)
+		return nil
+	})
+	for i := 0; i < 30; i++ {
+		key := fmt.Sprint(i % 3)
+		publish(t, broker, fmt.Sprint(i), map[string]string{"order_id": key, "seq": fmt.Sprint(i)})
+	}
+
+	eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(seen["0"])+len(seen["1"])+len(seen["2"]) == 30
+	}, "not every message was handled")
+	mu.Lock()
+	defer mu.Unlock()
+	for key, seqs := range seen {
+		for i := 1; i < len(seqs); i++ {
+			if seqs[i] < seqs[i-1] {
+				t.Fatalf("key %s handled out of order: %v", key, seqs)
+			}
+		}
+	}
+}
+
+func TestRunnerPause(t *testing.T) {
+	var calls attempts
+	broker, runner := startRunner(t, RunnerOptions{}, func(ctx context.Context, m Message) error {
+		calls.add(m.ID)
+		return nil
+	})
+
+	runner.Pause("test")
+	eventually(t, func() bool { return len(runner.PauseReasons()) == 1 }, "runner not paused")
+	time.Sleep(20 * time.Millisecond) // let the subscription be cancelled
+	publish(t, broker, "m1", nil)
+	time.Sleep(50 * time.Millisecond)
+	if got := calls.get("m1"); got != 0 {
+		t.Fatalf("paused runner handled the message %d times", got)
+	}
+
+	runner.Resume("test")
+	eventually(t, func() bool { return calls.get("m1") == 1 }, "message not handled after resume")
+}
@@ -0,0 +1,180 @@
+package queue
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// Memory is an in-process broker for tests and local runs. Every published message goes to a
+// single queue regardless of its routing key, and failed messages are retried after the retry
+// delay or parked, like on RabbitMQ. Nothing survives a restart.
+type Memory struct {
+	retry RetryPolicy
+	queue chan Message
+
+	mu      sync.Mutex
+	nextTag uint64
+	unacked map[uint64]Message
+	parked  []Message
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewMemory creates an in-memory broker; publishers block once capacity messages are waiting
+func NewMemory(capacity int, retry RetryPolicy) *Memory {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Memory{
+		retry:   retry,
+		queue:   make(chan Message, capacity),
+		unacked: make(map[uint64]Message),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+// PublishWithConfirm queues the message, building it the same way RabbitMQ does
+func (m *Memory) PublishWithConfirm(ctx context.Context, routingKey, msgID, eventName string, payload []byte, ref map[string]string) error {
+	msg := newPublishing(msgID, eventName, payload, ref)
+	return m.enqueue(ctx, Message{
+		ID:            msg.MessageId,
+		Type:          msg.Type,
+		RoutingKey:    routingKey,
+		ContentType:   msg.ContentType,
+		CorrelationID: msg.CorrelationId,
+		Timestamp:     msg.Timestamp,
+		Headers:       msg.Headers,
+		Body:          msg.Body,
+	})
+}
+
+func (m *Memory) enqueue(ctx context.Context, msg Message) error {
+	m.mu.Lock()
+	m.nextTag++
+	tag := m.nextTag
+	msg.Acknowledger = memoryAck{broker: m, tag: tag}
+	m.unacked[tag] = msg
+	m.mu.Unlock()
+
+	select {
+	case <-m.ctx.Done():
+		m.settle(tag)
+		return ErrStopped
+	case <-ctx.Done():
+		m.settle(tag)
+		return ctx.Err()
+	case m.queue <- msg:
+		return nil
+	}
+}
+
+// GetConsumerChannel returns messages until ctx is cancelled or the broker is stopped.
+// Consumers share the queue, so each message goes to exactly one of them.
+func (m *Memory) GetConsumerChannel(ctx context.Context, opts ConsumerOptions) (<-chan Message, error) {
+	if m.ctx.Err() != nil {
+		return nil, ErrStopped
+	}
+	out := make(chan Message)
+	go func() {
+		defer close(out)
+		forward(ctx, m.ctx, m.queue, out, func(msg Message) Message { return msg })
+	}()
+	return out, nil
+}
+
+// Retry acks msg and queues a copy after the retry delay, or parks it once MaxAttempts is reached
+func (m *Memory) Retry(msg Message, reason error) error {
+	attempts := RetryCount(msg) + 1
+	retried := msg
+	retried.Headers = failureHeaders(msg, attempts, reason)
+	retried.Redelivered = false
+
+	if attempts >= m.retry.MaxAttempts {
+		return m.park(msg, retried, attempts, reason)
+	}
+
+	time.AfterFunc(m.retry.Delay, func() {
+		if err := m.enqueue(context.Background(), retried); err != nil {
+			log.Printf("Failed to requeue message %s: %v", msg.ID, err)
+		}
+	})
+	log.Printf("Message %s scheduled for retry %d/%d in %v: %v", msg.ID, attempts, m.retry.MaxAttempts, m.retry.Delay, reason)
+	return msg.Ack()
+}
+
+// RetryLater acks msg and queues a copy after the retry delay without raising its retry count
+func (m *Memory) RetryLater(msg Message, reason error) error {
+	retried := msg
+	retried.Headers = failureHeaders(msg, RetryCount(msg), reason)
+	retried.Redelivered = false
+
+	time.AfterFunc(m.retry.Delay, func() {
+		if err := m.enqueue(context.Background(), retried); err != nil {
+			log.Printf("Failed to requeue message %s: %v", msg.ID, err)
+		}
+	})
+	log.Printf("Message %s redelivered in %v: %v", msg.ID, m.retry.Delay, reason)
+	return msg.Ack()
+}
+
+// Park acks msg and moves it straight to the parked messages
+func (m *Memory) Park(msg Message, reason error) error {
+	attempts := RetryCount(msg) + 1
+	parked := msg
+	parked.Headers = failureHeaders(msg, attempts, reason)
+	parked.Redelivered = false
+	return m.park(msg, parked, attempts, reason)
+}
+
+func (m *Memory) park(msg, parked Message, attempts int, reason error) error {
+	parked.Acknowledger = nil
+	m.mu.Lock()
+	m.parked = append(m.parked, parked)
+	m.mu.Unlock()
+	log.Printf("Message %s parked after %d attempts: %v", msg.ID, attempts, reason)
+	return msg.Ack()
+}
+
+// Parked returns the messages that exhausted their retries or were dead lettered
+func (m *Memory) Parked() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Message(nil), m.parked...)
+}
+
+// settle removes an unacked message and returns it, reporting false if it was already settled
+func (m *Memory) settle(tag uint64) (Message, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	msg, ok := m.unacked[tag]
+	delete(m.unacked, tag)
+	return msg, ok
+}
+
+// Stop closes the consumer channels; queued messages are dropped
+func (m *Memory) Stop(ctx context.Context) {
+	m.cancel()
+}
+
+// memoryAck settles one message of a Memory broker
+type memoryAck struct {
+	broker *Memory
+	tag    uint64
+}
+
+func (a memoryAck) Ack() error {
+	a.broker.settle(a.tag)
+	return nil
+}
+
+// Nack requeues the message with Redelivered set, or drops it
+func (a memoryAck) Nack(requeue bool) error {
+	msg, ok := a.broker.settle(a.tag)
+	if ok && requeue {
+		msg.Redelivered = true
+		go a.broker.enqueue(a.broker.ctx, msg)
+	}
+	return nil
+}
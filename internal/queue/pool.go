@@ -0,0 +1,90 @@
+package queue
+
+import (
+	"context"
+
+	"github.com/streadway/amqp"
+)
+
+// DefaultPublisherPoolSize is the number of publisher channels used when Config.PublisherPoolSize is not set
+const DefaultPublisherPoolSize = 4
+
+// channelPool lends confirm-mode publisher channels to one caller at a time, since an
+// amqp.Channel is not safe for concurrent use. Callers wait when every channel is borrowed.
+type channelPool struct {
+	conn func() (*amqp.Connection, error)
+	// slots holds one entry per pooled channel; nil means the channel has not been opened yet
+	slots chan *publisher
+}
+
+func newChannelPool(size int, conn func() (*amqp.Connection, error)) *channelPool {
+	if size <= 0 {
+		size = DefaultPublisherPoolSize
+	}
+	p := &channelPool{
+		conn:  conn,
+		slots: make(chan *publisher, size),
+	}
+	for i := 0; i < size; i++ {
+		p.slots <- nil
+	}
+	return p
+}
+
+// get borrows a channel, replacing it if it broke or belongs to a previous connection.
+// Every successful get must be followed by put.
+func (p *channelPool) get(ctx context.Context) (*publisher, error) {
+	var pub *publisher
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case pub = <-p.slots:
+	}
+
+	conn, err := p.conn()
+	if err != nil {
+		p.slots <- pub
+		return nil, err
+	}
+	if pub != nil && (pub.isClosed() || pub.conn != conn) {
+		pub.close()
+		pub = nil
+	}
+	if pub == nil {
+		pub, err = newPublisher(conn)
+		if err != nil {
+			p.slots <- nil
+			return nil, err
+		}
+	}
+	return pub, nil
+}
+
+// put returns a borrowed channel to the pool
+func (p *channelPool) put(pub *publisher) {
+	p.slots <- pub
+}
+
+// close closes the idle channels; borrowed ones are closed together with the connection
+func (p *channelPool) close() {
+	for {
+		select {
+		case pub := <-p.slots:
+			if pub != nil {
+				pub.close()
+			}
+		default:
+			return
+		}
+	}
+}
+
+// publish sends msg on a pooled channel and waits for the broker to confirm it
+func (r *RabbitMQ) publish(ctx context.Context, exchange, routingKey string, msg amqp.Publishing) error {
+	pub, err := r.pool.get(ctx)
+	if err != nil {
+		return err
+	}
+	defer r.pool.put(pub)
+	return pub.publish(ctx, exchange, routingKey, msg)
+}
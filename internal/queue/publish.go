@@ -0,0 +1,192 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// defaultPublishTimeout bounds Publish calls that do not carry their own context
+const defaultPublishTimeout = 5 * time.Second
+
+const (
+	// CorrelationIDKey is the ref entry copied into the message CorrelationId; the message ID is used when absent
+	CorrelationIDKey = "correlation_id"
+	// ContentTypeKey is the ref entry used as the message ContentType instead of a header, defaults to application/json
+	ContentTypeKey = "content_type"
+)
+
+var (
+	// ErrPublishNacked means the broker refused to take responsibility for the message
+	ErrPublishNacked = errors.New("publish nacked by broker")
+	// ErrPublishUnroutable means a mandatory message matched no queue and was returned
+	ErrPublishUnroutable = errors.New("publish returned as unroutable")
+)
+
+// PublishError describes a message the broker did not accept.
+// Use errors.Is with ErrPublishNacked or ErrPublishUnroutable to tell the cases apart.
+type PublishError struct {
+	Err        error
+	Exchange   string
+	RoutingKey string
+	ReplyCode  uint16
+	ReplyText  string
+}
+
+func (e *PublishError) Error() string {
+	if e.ReplyText != "" {
+		return fmt.Sprintf("%v: exchange=%q routing_key=%q: %d %s", e.Err, e.Exchange, e.RoutingKey, e.ReplyCode, e.ReplyText)
+	}
+	return fmt.Sprintf("%v: exchange=%q routing_key=%q", e.Err, e.Exchange, e.RoutingKey)
+}
+
+func (e *PublishError) Unwrap() error {
+	return e.Err
+}
+
+// publisher is a confirm-mode channel. Publishes are serialized so that every
+// confirmation and return can be matched to the message waiting for it.
+type publisher struct {
+	mu        sync.Mutex
+	conn      *amqp.Connection
+	ch        *amqp.Channel
+	confirms  chan amqp.Confirmation
+	returns   chan amqp.Return
+	published uint64
+	// closed is closed once the channel dies, e.g. after publishing to a missing exchange
+	closed chan struct{}
+}
+
+func newPublisher(conn *amqp.Connection) (*publisher, error) {
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+	if err := ch.Confirm(false); err != nil {
+		ch.Close()
+		return nil, err
+	}
+	p := &publisher{
+		conn:     conn,
+		ch:       ch,
+		confirms: ch.NotifyPublish(make(chan amqp.Confirmation, 16)),
+		returns:  ch.NotifyReturn(make(chan amqp.Return, 16)),
+		closed:   make(chan struct{}),
+	}
+	chClosed := ch.NotifyClose(make(chan *amqp.Error, 1))
+	go func() {
+		<-chClosed
+		close(p.closed)
+	}()
+	return p, nil
+}
+
+func (p *publisher) isClosed() bool {
+	select {
+	case <-p.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// publish sends msg as mandatory and waits for the broker ack, nack or return
+func (p *publisher) publish(ctx context.Context, exchange, routingKey string, msg amqp.Publishing) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.ch.Publish(exchange, routingKey, true, false, msg); err != nil {
+		return err
+	}
+	p.published++
+	tag := p.published
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case confirm, ok := <-p.confirms:
+			if !ok {
+				return fmt.Errorf("publisher channel closed before confirm: %w", ErrNotConnected)
+			}
+			// The broker sends basic.return before the ack of the same message,
+			// so a pending return belongs to the confirmation just received
+			var ret *amqp.Return
+			select {
+			case r := <-p.returns:
+				ret = &r
+			default:
+			}
+
+			if confirm.DeliveryTag < tag {
+				// Left over from an earlier publish whose caller gave up waiting
+				continue
+			}
+			if ret != nil {
+				return &PublishError{
+					Err:        ErrPublishUnroutable,
+					Exchange:   exchange,
+					RoutingKey: routingKey,
+					ReplyCode:  ret.ReplyCode,
+					ReplyText:  ret.ReplyText,
+				}
+			}
+			if !confirm.Ack {
+				return &PublishError{Err: ErrPublishNacked, Exchange: exchange, RoutingKey: routingKey}
+			}
+			return nil
+		}
+	}
+}
+
+func (p *publisher) close() {
+	p.ch.Close()
+}
+
+// PublishWithConfirm publishes a persistent, mandatory message to the configured exchange and
+// waits until the broker acks it. eventName becomes the message Type and ref entries become headers.
+// It returns a *PublishError when the message is nacked or returned as unroutable.
+func (r *RabbitMQ) PublishWithConfirm(ctx context.Context, routingKey, msgID, eventName string, payload []byte, ref map[string]string) error {
+	return r.publish(ctx, r.cfg.Exchange, routingKey, newPublishing(msgID, eventName, payload, ref))
+}
+
+func newPublishing(msgID, eventName string, payload []byte, ref map[string]string) amqp.Publishing {
+	headers := make(amqp.Table, len(ref))
+	for k, v := range ref {
+		if k != ContentTypeKey {
+			headers[k] = v
+		}
+	}
+
+	contentType := ref[ContentTypeKey]
+	if contentType == "" {
+		contentType = "application/json"
+	}
+
+	correlationID := ref[CorrelationIDKey]
+	if correlationID == "" {
+		correlationID = msgID
+	}
+
+	return amqp.Publishing{
+		Headers:       headers,
+		ContentType:   contentType,
+		DeliveryMode:  amqp.Persistent,
+		CorrelationId: correlationID,
+		MessageId:     msgID,
+		Timestamp:     time.Now().UTC(),
+		Type:          eventName,
+		Body:          payload,
+	}
+}
+
+// Publish is PublishWithConfirm with a default timeout
+func (r *RabbitMQ) Publish(routingKey, msgID, eventName string, payload []byte, ref map[string]string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultPublishTimeout)
+	defer cancel()
+	return r.PublishWithConfirm(ctx, routingKey, msgID, eventName, payload, ref)
+}
@@ -0,0 +1,73 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Publisher publishes a message and returns once the broker has taken responsibility for it.
+// eventName becomes the message Type and ref entries become headers.
+type Publisher interface {
+	PublishWithConfirm(ctx context.Context, routingKey, msgID, eventName string, payload []byte, ref map[string]string) error
+}
+
+// Consumer delivers messages from the configured queue
+type Consumer interface {
+	GetConsumerChannel(ctx context.Context, opts ConsumerOptions) (<-chan Message, error)
+	// Retry acks m and redelivers a copy later, or parks it once the retry policy is exhausted
+	Retry(m Message, reason error) error
+	// Park acks m and moves a copy to the parking lot (dead letter queue) without retrying
+	Park(m Message, reason error) error
+	// RetryLater acks m and redelivers a copy after the retry delay without counting an attempt
+	RetryLater(m Message, reason error) error
+}
+
+// Acknowledger settles a message with the broker it was consumed from
+type Acknowledger interface {
+	Ack() error
+	Nack(requeue bool) error
+}
+
+// Message is a consumed message, independent of the broker behind it
+type Message struct {
+	ID            string
+	Type          string
+	RoutingKey    string
+	ContentType   string
+	CorrelationID string
+	Timestamp     time.Time
+	Headers       map[string]interface{}
+	Body          []byte
+	// Redelivered is set when the broker delivered the message before without it being settled
+	Redelivered bool
+
+	Acknowledger Acknowledger
+}
+
+// Ack tells the broker the message was handled
+func (m Message) Ack() error {
+	return m.Acknowledger.Ack()
+}
+
+// Nack rejects the message, putting it back on the queue when requeue is set
+func (m Message) Nack(requeue bool) error {
+	return m.Acknowledger.Nack(requeue)
+}
+
+var (
+	// ErrRequeue tells the Runner to put the delivery back on the queue right away instead of retrying it later
+	ErrRequeue = errors.New("requeue message")
+	// ErrDeadLetter tells the Runner to park the delivery without retrying, e.g. for messages that can never succeed
+	ErrDeadLetter = errors.New("dead letter message")
+	// ErrRetryLater tells the Runner to redeliver the message after the retry delay without counting it
+	// toward MaxAttempts, e.g. while another consumer holds it
+	ErrRetryLater = errors.New("retry message later")
+)
+
+var (
+	_ Publisher = (*RabbitMQ)(nil)
+	_ Consumer  = (*RabbitMQ)(nil)
+	_ Publisher = (*Memory)(nil)
+	_ Consumer  = (*Memory)(nil)
+)
@@ -0,0 +1,127 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+const (
+	retryCountHeader    = "x-retry-count"
+	failureReasonHeader = "x-failure-reason"
+	failedAtHeader      = "x-failed-at"
+)
+
+// RetryPolicy controls what happens to a message whose handler failed: it waits Delay in a
+// retry queue and goes back to the main queue, until MaxAttempts is reached and it is parked.
+type RetryPolicy struct {
+	MaxAttempts int
+	Delay       time.Duration
+}
+
+func retryQueueName(queue string) string      { return queue + ".retry" }
+func parkingLotQueueName(queue string) string { return queue + ".parking_lot" }
+
+// retryTopology holds failed messages in a TTL queue that dead-letters back into the main
+// queue through the default exchange, plus a parking lot for messages that keep failing
+func retryTopology(queue string, policy RetryPolicy) []Queue {
+	return []Queue{
+		{
+			Name:                 retryQueueName(queue),
+			Durable:              true,
+			MessageTTL:           policy.Delay,
+			DeadLetterRoutingKey: queue,
+			// Expired messages go through the default exchange, which routes by queue name
+			Args: amqp.Table{"x-dead-letter-exchange": ""},
+		},
+		{Name: parkingLotQueueName(queue), Durable: true},
+	}
+}
+
+// RetryCount returns how many times the message has already failed
+func RetryCount(m Message) int {
+	switch v := m.Headers[retryCountHeader].(type) {
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	case int:
+		return v
+	default:
+		return 0
+	}
+}
+
+// failureHeaders copies the message headers and records the attempt count and failure reason
+func failureHeaders(m Message, attempts int, reason error) map[string]interface{} {
+	headers := make(map[string]interface{}, len(m.Headers)+3)
+	for k, v := range m.Headers {
+		headers[k] = v
+	}
+	headers[retryCountHeader] = int32(attempts)
+	headers[failureReasonHeader] = reason.Error()
+	headers[failedAtHeader] = time.Now().UTC().Format(time.RFC3339)
+	return headers
+}
+
+// Retry schedules a failed message for another attempt after the retry delay, or moves it to the
+// parking lot once MaxAttempts is reached. The failure reason is kept in the x-failure-reason header.
+// The original message is acked only after the copy is confirmed, otherwise it is requeued.
+func (r *RabbitMQ) Retry(m Message, reason error) error {
+	attempts := RetryCount(m) + 1
+	if attempts >= r.cfg.Retry.MaxAttempts {
+		return r.moveTo(m, parkingLotQueueName(r.cfg.Queue), attempts, reason)
+	}
+	if err := r.moveTo(m, retryQueueName(r.cfg.Queue), attempts, reason); err != nil {
+		return err
+	}
+	log.Printf("Message %s scheduled for retry %d/%d in %v: %v", m.ID, attempts, r.cfg.Retry.MaxAttempts, r.cfg.Retry.Delay, reason)
+	return nil
+}
+
+// RetryLater sends a message through the retry queue again without raising its retry count,
+// for messages that could not be handled yet rather than ones that failed
+func (r *RabbitMQ) RetryLater(m Message, reason error) error {
+	attempts := RetryCount(m)
+	if err := r.moveTo(m, retryQueueName(r.cfg.Queue), attempts, reason); err != nil {
+		return err
+	}
+	log.Printf("Message %s redelivered in %v: %v", m.ID, r.cfg.Retry.Delay, reason)
+	return nil
+}
+
+// Park moves a message straight to the parking lot, for failures that retrying will not fix
+func (r *RabbitMQ) Park(m Message, reason error) error {
+	return r.moveTo(m, parkingLotQueueName(r.cfg.Queue), RetryCount(m)+1, reason)
+}
+
+// moveTo publishes a copy of m to the target queue, then acks m
+func (r *RabbitMQ) moveTo(m Message, target string, attempts int, reason error) error {
+	msg := amqp.Publishing{
+		Headers:       amqp.Table(failureHeaders(m, attempts, reason)),
+		ContentType:   m.ContentType,
+		DeliveryMode:  amqp.Persistent,
+		CorrelationId: m.CorrelationID,
+		MessageId:     m.ID,
+		Timestamp:     m.Timestamp,
+		Type:          m.Type,
+		Body:          m.Body,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), defaultPublishTimeout)
+	defer cancel()
+
+	// Published through the default exchange, which routes by queue name
+	if err := r.publish(ctx, "", target, msg); err != nil {
+		m.Nack(true)
+		return fmt.Errorf("move message %s to %s: %w", m.ID, target, err)
+	}
+
+	if target == parkingLotQueueName(r.cfg.Queue) {
+		log.Printf("Message %s parked after %d attempts: %v", m.ID, attempts, reason)
+	}
+	return m.Ack()
+}
@@ -0,0 +1,113 @@
+package queue
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// Exchange declares an exchange
+type Exchange struct {
+	Name string
+	// Kind is one of amqp.ExchangeDirect, ExchangeTopic, ExchangeFanout or ExchangeHeaders
+	Kind       string
+	Durable    bool
+	AutoDelete bool
+	Internal   bool
+	Args       amqp.Table
+}
+
+// Queue declares a queue. The typed fields cover the common x-arguments; Args is applied last.
+type Queue struct {
+	Name       string
+	Durable    bool
+	AutoDelete bool
+	Exclusive  bool
+
+	MessageTTL           time.Duration
+	MaxLength            int
+	Quorum               bool
+	DeadLetterExchange   string
+	DeadLetterRoutingKey string
+	Args                 amqp.Table
+}
+
+func (q Queue) arguments() amqp.Table {
+	args := amqp.Table{}
+	if q.MessageTTL > 0 {
+		args["x-message-ttl"] = q.MessageTTL.Milliseconds()
+	}
+	if q.MaxLength > 0 {
+		args["x-max-length"] = int64(q.MaxLength)
+	}
+	if q.Quorum {
+		args["x-queue-type"] = "quorum"
+	}
+	if q.DeadLetterExchange != "" {
+		args["x-dead-letter-exchange"] = q.DeadLetterExchange
+	}
+	if q.DeadLetterRoutingKey != "" {
+		args["x-dead-letter-routing-key"] = q.DeadLetterRoutingKey
+	}
+	for k, v := range q.Args {
+		args[k] = v
+	}
+	if len(args) == 0 {
+		return nil
+	}
+	return args
+}
+
+// Binding routes messages from an exchange to a queue
+type Binding struct {
+	Queue      string
+	Exchange   string
+	RoutingKey string
+	Args       amqp.Table
+}
+
+// Topology is the set of exchanges, queues and bindings the service needs.
+// It is applied on connect and on every reconnect; declaring is idempotent as long as
+// the definition does not change for an existing entity.
+type Topology struct {
+	Exchanges []Exchange
+	Queues    []Queue
+	Bindings  []Binding
+}
+
+// Apply declares exchanges, then queues, then bindings
+func (t Topology) Apply(ch *amqp.Channel) error {
+	for _, e := range t.Exchanges {
+		if err := ch.ExchangeDeclare(e.Name, e.Kind, e.Durable, e.AutoDelete, e.Internal, false, e.Args); err != nil {
+			return fmt.Errorf("declare exchange %s: %w", e.Name, err)
+		}
+	}
+	for _, q := range t.Queues {
+		if _, err := ch.QueueDeclare(q.Name, q.Durable, q.AutoDelete, q.Exclusive, false, q.arguments()); err != nil {
+			return fmt.Errorf("declare queue %s: %w", q.Name, err)
+		}
+	}
+	for _, b := range t.Bindings {
+		if err := ch.QueueBind(b.Queue, b.RoutingKey, b.Exchange, false, b.Args); err != nil {
+			return fmt.Errorf("bind queue %s to %s with %q: %w", b.Queue, b.Exchange, b.RoutingKey, err)
+		}
+	}
+	return nil
+}
+
+// DefaultTopology binds the consumer queue to every order event published on the exchange
+// and adds the retry and parking lot queues used by RabbitMQ.Retry
+func DefaultTopology(exchange, queue string, retry RetryPolicy) Topology {
+	return Topology{
+		Exchanges: []Exchange{
+			{Name: exchange, Kind: amqp.ExchangeTopic, Durable: true},
+		},
+		Queues: append([]Queue{
+			{Name: queue, Durable: true},
+		}, retryTopology(queue, retry)...),
+		Bindings: []Binding{
+			{Queue: queue, Exchange: exchange, RoutingKey: "order.#"},
+		},
+	}
+}
@@ -0,0 +1,187 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"time"
+
+	"lmwn_gomeetup_failover/internal/queue"
+)
+
+// Logging logs every delivery with its outcome and handling time
+func Logging() Middleware {
+	return func(next queue.Handler) queue.Handler {
+		return func(ctx context.Context, m queue.Message) error {
+			start := time.Now()
+			err := next(ctx, m)
+			if err != nil {
+				log.Printf("Message %s (%s) failed after %v: %v", m.ID, MessageType(m), time.Since(start), err)
+			} else {
+				log.Printf("Message %s (%s) handled in %v", m.ID, MessageType(m), time.Since(start))
+			}
+			return err
+		}
+	}
+}
+
+// Recovery turns a handler panic into an error so the message is retried
+func Recovery() Middleware {
+	return func(next queue.Handler) queue.Handler {
+		return func(ctx context.Context, m queue.Message) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					log.Printf("Recovered from panic handling message %s: %v\nStack Trace: %s", m.ID, r, debug.Stack())
+					err = fmt.Errorf("handler panic: %v", r)
+				}
+			}()
+			return next(ctx, m)
+		}
+	}
+}
+
+// Metrics counts deliveries per message type and outcome ("<type>.ok", "<type>.failed", ...)
+// and sums their handling time in "<type>.seconds". Publish vars with expvar to expose them.
+func Metrics(vars *expvar.Map) Middleware {
+	return func(next queue.Handler) queue.Handler {
+		return func(ctx context.Context, m queue.Message) error {
+			start := time.Now()
+			err := next(ctx, m)
+
+			outcome := "ok"
+			switch {
+			case err == nil:
+			case errors.Is(err, queue.ErrRequeue):
+				outcome = "requeued"
+			case errors.Is(err, queue.ErrDeadLetter):
+				outcome = "dead_lettered"
+			case errors.Is(err, queue.ErrRetryLater):
+				outcome = "retried_later"
+			default:
+				outcome = "failed"
+			}
+			msgType := MessageType(m)
+			vars.Add(msgType+"."+outcome, 1)
+			vars.AddFloat(msgType+".seconds", time.Since(start).Seconds())
+			return err
+		}
+	}
+}
+
+var (
+	// ErrAlreadyProcessed is returned by ProcessedStore.Claim for messages handled before
+	ErrAlreadyProcessed = errors.New("message already processed")
+	// ErrInProgress is returned by ProcessedStore.Claim while another handler holds the message
+	ErrInProgress = errors.New("message is being processed")
+	// ErrClaimLost is returned when a claim expired and another handler took the message over
+	ErrClaimLost = errors.New("message claim lost")
+)
+
+// Claim is a lease on a message held by one handler. The token identifies the holder, so a handler
+// whose lease expired cannot complete or release the claim of the handler that took over.
+type Claim struct {
+	Token      string
+	LeaseUntil time.Time
+}
+
+// ProcessedStore remembers which messages have been handled
+type ProcessedStore interface {
+	// Claim reserves a message for this handler, or returns ErrAlreadyProcessed or ErrInProgress
+	Claim(ctx context.Context, msgID string) (Claim, error)
+	// Renew extends a claim still held with token and returns the new lease end, or ErrClaimLost
+	Renew(ctx context.Context, msgID, token string) (time.Time, error)
+	// Complete marks a message claimed with token as processed, or returns ErrClaimLost
+	Complete(ctx context.Context, msgID, token string) error
+	// Release drops the claim held with token so the message can be handled again
+	Release(ctx context.Context, msgID, token string) error
+}
+
+// Idempotency skips messages that were already processed, keyed by message ID. The claim is renewed
+// while the handler runs, so handlers may take longer than the lease. Messages claimed by another
+// handler are redelivered with queue.ErrRetryLater, which does not use up their retry attempts, so
+// they are handled once that handler's claim expires if it dies before completing them.
+func Idempotency(store ProcessedStore) Middleware {
+	return func(next queue.Handler) queue.Handler {
+		return func(ctx context.Context, m queue.Message) error {
+			if m.ID == "" {
+				return next(ctx, m)
+			}
+
+			claim, err := store.Claim(ctx, m.ID)
+			if errors.Is(err, ErrAlreadyProcessed) {
+				log.Printf("Skipping duplicate message %s", m.ID)
+				return nil
+			}
+			if errors.Is(err, ErrInProgress) {
+				return fmt.Errorf("%w: claim message %s: %w", queue.ErrRetryLater, m.ID, err)
+			}
+			if err != nil {
+				return fmt.Errorf("claim message %s: %w", m.ID, err)
+			}
+
+			stopRenewing := renewClaim(store, m.ID, claim)
+			err = next(ctx, m)
+			stopRenewing()
+
+			// Settled with a fresh context so a cancelled handler context does not keep the claim,
+			// otherwise finished work is handled again once the claim expires
+			settleCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			if err != nil {
+				if relErr := store.Release(settleCtx, m.ID, claim.Token); relErr != nil {
+					log.Printf("Failed to release message %s: %v", m.ID, relErr)
+				}
+				return err
+			}
+
+			// The work is done, so a failure here must not trigger a retry
+			if err := store.Complete(settleCtx, m.ID, claim.Token); err != nil {
+				log.Printf("Failed to mark message %s processed: %v", m.ID, err)
+			}
+			return nil
+		}
+	}
+}
+
+// renewClaim extends the claim at half of its remaining lease until the returned stop is called
+func renewClaim(store ProcessedStore, msgID string, claim Claim) (stop func()) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		leaseUntil := claim.LeaseUntil
+		for {
+			wait := time.Until(leaseUntil) / 2
+			if wait < time.Second {
+				wait = time.Second
+			}
+			timer := time.NewTimer(wait)
+			select {
+			case <-done:
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			next, err := store.Renew(ctx, msgID, claim.Token)
+			cancel()
+			if errors.Is(err, ErrClaimLost) {
+				log.Printf("Lost claim on message %s, another handler took it over", msgID)
+				return
+			} else if err != nil {
+				log.Printf("Failed to renew claim on message %s: %v", msgID, err)
+				continue
+			}
+			leaseUntil = next
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
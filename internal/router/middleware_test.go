@@ -0,0 +1,119 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"lmwn_gomeetup_failover/internal/queue"
+)
+
+// fakeStore records calls and hands out a fixed claim
+type fakeStore struct {
+	mu        sync.Mutex
+	claimErr  error
+	claim     Claim
+	renewed   int
+	completed []string
+	released  []string
+}
+
+func (s *fakeStore) Claim(ctx context.Context, msgID string) (Claim, error) {
+	return s.claim, s.claimErr
+}
+
+func (s *fakeStore) Renew(ctx context.Context, msgID, token string) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.renewed++
+	return time.Now(), nil
+}
+
+func (s *fakeStore) Complete(ctx context.Context, msgID, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.completed = append(s.completed, token)
+	return ctx.Err()
+}
+
+func (s *fakeStore) Release(ctx context.Context, msgID, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.released = append(s.released, token)
+	return ctx.Err()
+}
+
+func TestIdempotencyCompletesWithClaimToken(t *testing.T) {
+	store := &fakeStore{claim: Claim{Token: "t1", LeaseUntil: time.Now().Add(time.Minute)}}
+	ctx, cancel := context.WithCancel(context.Background())
+	h := Idempotency(store)(func(ctx context.Context, m queue.Message) error {
+		// A handler context cancelled at the end of the work must not keep the message unfinished
+		cancel()
+		return nil
+	})
+
+	if err := h(ctx, queue.Message{ID: "m1"}); err != nil {
+		t.Fatalf("handler error = %v", err)
+	}
+	if len(store.completed) != 1 || store.completed[0] != "t1" {
+		t.Fatalf("completed = %v, want [t1]", store.completed)
+	}
+}
+
+func TestIdempotencyReleasesFailedClaim(t *testing.T) {
+	store := &fakeStore{claim: Claim{Token: "t1", LeaseUntil: time.Now().Add(time.Minute)}}
+	errFailed := errors.New("failed")
+	h := Idempotency(store)(func(ctx context.Context, m queue.Message) error { return errFailed })
+
+	if err := h(context.Background(), queue.Message{ID: "m1"}); !errors.Is(err, errFailed) {
+		t.Fatalf("handler error = %v, want %v", err, errFailed)
+	}
+	if len(store.released) != 1 || store.released[0] != "t1" || len(store.completed) != 0 {
+		t.Fatalf("released = %v, completed = %v, want only t1 released", store.released, store.completed)
+	}
+}
+
+func TestIdempotencyOutcomes(t *testing.T) {
+	for _, tt := range []struct {
+		claimErr error
+		want     error
+	}{
+		{claimErr: ErrAlreadyProcessed, want: nil},
+		{claimErr: ErrInProgress, want: queue.ErrRetryLater},
+	} {
+		store := &fakeStore{claimErr: tt.claimErr}
+		called := false
+		h := Idempotency(store)(func(ctx context.Context, m queue.Message) error {
+			called = true
+			return nil
+		})
+
+		err := h(context.Background(), queue.Message{ID: "m1"})
+		if tt.want == nil && err != nil || tt.want != nil && !errors.Is(err, tt.want) {
+			t.Errorf("claim error %v: got %v, want %v", tt.claimErr, err, tt.want)
+		}
+		if called {
+			t.Errorf("claim error %v: handler was called", tt.claimErr)
+		}
+	}
+}
+
+func TestIdempotencyRenewsLongRunningClaim(t *testing.T) {
+	// The lease is already at its end, so the claim is renewed after the minimum wait of a second
+	store := &fakeStore{claim: Claim{Token: "t1", LeaseUntil: time.Now()}}
+	h := Idempotency(store)(func(ctx context.Context, m queue.Message) error {
+		time.Sleep(1200 * time.Millisecond)
+		return nil
+	})
+
+	if err := h(context.Background(), queue.Message{ID: "m1"}); err != nil {
+		t.Fatalf("handler error = %v", err)
+	}
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if store.renewed == 0 {
+		t.Fatal("claim was not renewed while the handler ran")
+	}
+}
@@ -0,0 +1,115 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"lmwn_gomeetup_failover/internal/event"
+	"lmwn_gomeetup_failover/internal/queue"
+)
+
+// UnknownPolicy decides what happens to a message no handler is registered for
+type UnknownPolicy int
+
+const (
+	// UnknownDeadLetter parks the message so it can be inspected and replayed
+	UnknownDeadLetter UnknownPolicy = iota
+	// UnknownDrop acks and discards the message
+	UnknownDrop
+	// UnknownRequeue redelivers the message after the retry delay without using up its attempts,
+	// e.g. for another consumer version during a rolling deploy
+	UnknownRequeue
+)
+
+func (p UnknownPolicy) String() string {
+	switch p {
+	case UnknownDeadLetter:
+		return "dead_letter"
+	case UnknownDrop:
+		return "drop"
+	case UnknownRequeue:
+		return "requeue"
+	default:
+		return "unknown"
+	}
+}
+
+// Middleware wraps the handling of every delivery, including unknown and undecodable ones
+type Middleware func(next queue.Handler) queue.Handler
+
+// Router dispatches deliveries to the handler registered for their message type,
+// falling back to the routing key when the type is not set
+type Router struct {
+	routes     map[string]queue.Handler
+	middleware []Middleware
+	unknown    UnknownPolicy
+}
+
+func New(unknown UnknownPolicy) *Router {
+	return &Router{
+		routes:  make(map[string]queue.Handler),
+		unknown: unknown,
+	}
+}
+
+// Use appends middleware; the first one added is the outermost
+func (r *Router) Use(mw ...Middleware) {
+	r.middleware = append(r.middleware, mw...)
+}
+
+// Handle registers a raw handler for a message type, replacing any previous one
+func (r *Router) Handle(msgType string, h queue.Handler) {
+	r.routes[msgType] = h
+}
+
+// On registers a typed handler for the event type of T. The delivery is decoded and validated
+// before fn is called; messages that fail to decode are dead lettered since retrying cannot fix them.
+func On[T event.Payload](r *Router, fn func(ctx context.Context, env event.Envelope, data T) error) {
+	var zero T
+	r.Handle(zero.EventType(), func(ctx context.Context, m queue.Message) error {
+		env, payload, err := event.DecodeMessage(m.ContentType, m.Headers, m.Body)
+		if err != nil {
+			return fmt.Errorf("%w: %v", queue.ErrDeadLetter, err)
+		}
+		data, ok := payload.(T)
+		if !ok {
+			return fmt.Errorf("%w: %s decoded to %T", queue.ErrDeadLetter, env.Type, payload)
+		}
+		return fn(ctx, env, data)
+	})
+}
+
+// Handler returns the router as a queue.Handler with the middleware applied
+func (r *Router) Handler() queue.Handler {
+	h := queue.Handler(r.dispatch)
+	for i := len(r.middleware) - 1; i >= 0; i-- {
+		h = r.middleware[i](h)
+	}
+	return h
+}
+
+func (r *Router) dispatch(ctx context.Context, m queue.Message) error {
+	msgType := MessageType(m)
+	if h, ok := r.routes[msgType]; ok {
+		return h(ctx, m)
+	}
+
+	switch r.unknown {
+	case UnknownDrop:
+		log.Printf("Dropping message %s with unknown type %q", m.ID, msgType)
+		return nil
+	case UnknownRequeue:
+		return fmt.Errorf("%w: no handler for type %q", queue.ErrRetryLater, msgType)
+	default:
+		return fmt.Errorf("%w: no handler for type %q", queue.ErrDeadLetter, msgType)
+	}
+}
+
+// MessageType returns the type a delivery is routed by
+func MessageType(m queue.Message) string {
+	if m.Type != "" {
+		return m.Type
+	}
+	return m.RoutingKey
+}
@@ -0,0 +1,46 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"lmwn_gomeetup_failover/internal/queue"
+)
+
+func TestUnknownPolicies(t *testing.T) {
+	for _, tt := range []struct {
+		policy UnknownPolicy
+		want   error
+	}{
+		{policy: UnknownDeadLetter, want: queue.ErrDeadLetter},
+		{policy: UnknownDrop, want: nil},
+		{policy: UnknownRequeue, want: queue.ErrRetryLater},
+	} {
+		r := New(tt.policy)
+		err := r.Handler()(context.Background(), queue.Message{ID: "m1", Type: "unknown.type"})
+		if tt.want == nil && err != nil || tt.want != nil && !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.policy, err, tt.want)
+		}
+	}
+}
+
+func TestRouteByTypeThenRoutingKey(t *testing.T) {
+	r := New(UnknownDeadLetter)
+	var got []string
+	r.Handle("order.created", func(ctx context.Context, m queue.Message) error {
+		got = append(got, m.ID)
+		return nil
+	})
+
+	h := r.Handler()
+	if err := h(context.Background(), queue.Message{ID: "by-type", Type: "order.created", RoutingKey: "other"}); err != nil {
+		t.Fatalf("routing by type: %v", err)
+	}
+	if err := h(context.Background(), queue.Message{ID: "by-key", RoutingKey: "order.created"}); err != nil {
+		t.Fatalf("routing by routing key: %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("handled %v, want both messages", got)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"os"
 	"sync"
 	"time"
 
@@ -12,6 +13,9 @@ import (
 
 	"lmwn_gomeetup_failover/internal/circuitbreaker"
 	"lmwn_gomeetup_failover/internal/db"
+	"lmwn_gomeetup_failover/internal/event"
+	"lmwn_gomeetup_failover/internal/health"
+	"lmwn_gomeetup_failover/internal/outbox"
 	"lmwn_gomeetup_failover/internal/queue"
 	"lmwn_gomeetup_failover/internal/retry"
 	"lmwn_gomeetup_failover/internal/safe"
@@ -23,22 +27,59 @@ type Service struct {
 	shutdown   chan struct{}
 	mongo      *db.MongoDB
 	cb         *circuitbreaker.CircuitBreaker
-	rmq        *queue.RabbitMQ
+	outbox     *outbox.Store
+	relay      *outbox.Relay
 	workerPool *workerpool.WorkerPool
+	// eventContentType selects how published events are encoded, see event.EncodeMessage
+	eventContentType string
 }
 
-func NewService(mongo *db.MongoDB) *Service {
-	mq, err := queue.NewRabbitMQ()
-	if err != nil {
-		log.Fatalf("cannot init rabbitMQ %v", err)
+// Config holds the service settings
+type Config struct {
+	// EventContentType is event.ContentType (JSON) or event.ProtobufContentType. Consumers decode by
+	// content type, so both encodings can be in flight at the same time.
+	EventContentType string
+}
+
+func DefaultConfig() Config {
+	return Config{EventContentType: event.ContentType}
+}
+
+// ConfigFromEnv returns DefaultConfig overridden by EVENT_CONTENT_TYPE, e.g. EVENT_CONTENT_TYPE=application/protobuf
+func ConfigFromEnv() (Config, error) {
+	cfg := DefaultConfig()
+	if v := os.Getenv("EVENT_CONTENT_TYPE"); v != "" {
+		cfg.EventContentType = v
 	}
-	return &Service{
+	switch cfg.EventContentType {
+	case event.ContentType, event.ProtobufContentType:
+		return cfg, nil
+	default:
+		return cfg, fmt.Errorf("unsupported event content type %q", cfg.EventContentType)
+	}
+}
+
+// NewService wires the business logic to its dependencies; publisher receives the events relayed from the outbox
+func NewService(mongo *db.MongoDB, publisher queue.Publisher, cfg Config) *Service {
+	store := outbox.NewStore(mongo)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := store.EnsureIndexes(ctx); err != nil {
+		log.Printf("Failed to create outbox indexes: %v", err)
+	}
+
+	s := &Service{
 		shutdown:   make(chan struct{}),
 		mongo:      mongo,
 		cb:         circuitbreaker.NewCircuitBreaker(),
-		rmq:        mq,
+		outbox:     store,
+		relay:      outbox.NewRelay(store, publisher.PublishWithConfirm, outbox.DefaultRelayConfig()),
 		workerPool: workerpool.NewWorkerPool(5, 10), // 5 workers, queue size 10
+
+		eventContentType: cfg.EventContentType,
 	}
+	go s.relay.Start()
+	return s
 }
 
 func (s *Service) sendNotification(orderID string) {
@@ -57,8 +98,8 @@ func (s *Service) doPayment(orderID string) {
 
 func (s *Service) ProcessMessage(ctx context.Context, message string) error {
 	log.Printf("Processing message: %s", message)
-	// Example MongoDB interaction
-	collection := s.mongo.Client.Database("exampleDB").Collection("orders")
+	// Example MongoDB interaction, kept out of "orders" which holds the orders themselves
+	collection := s.mongo.Collection("order_events")
 	_, err := collection.InsertOne(ctx, map[string]string{"message": message})
 	if err != nil {
 		return err
@@ -66,11 +107,6 @@ func (s *Service) ProcessMessage(ctx context.Context, message string) error {
 	return nil
 }
 
-func (s *Service) IsMessageProcessed(message string) bool {
-	// Ensure idempotency before execution (e.g. check data state for the corresponding message)
-	return true
-}
-
 func (s *Service) ShouldProcessTask() bool {
 	// Ensure idempotency before execution (e.g. check data state, other ongoing cron process)
 	return true
@@ -110,9 +146,26 @@ func (s *Service) CallExternalAPIWithRetry() error {
 
 func (s *Service) BulkSendOrdersReminder(orderIDs []string) {
 	for _, orderID := range orderIDs {
-		s.workerPool.Submit(func() {
+		err := s.workerPool.Submit(func() {
 			s.sendNotification(orderID)
 		})
+		if err != nil {
+			log.Printf("Skipping reminder for order %s: %v", orderID, err)
+		}
+	}
+}
+
+// RegisterHealthChecks registers the circuit breaker guarding external calls as "circuit_breaker"
+func (s *Service) RegisterHealthChecks(registry *health.Registry) {
+	s.cb.RegisterHealthChecks(registry, "circuit_breaker")
+}
+
+// SetAcceptingTasks pauses or resumes background task submission, e.g. under memory pressure
+func (s *Service) SetAcceptingTasks(accepting bool) {
+	if accepting {
+		s.workerPool.Resume()
+	} else {
+		s.workerPool.Pause()
 	}
 }
 
@@ -138,28 +191,51 @@ func (s *Service) BulkSendOrdersReminderWithSemaphore(orderIDs []string) {
 	wg.Wait()
 }
 
-func (s *Service) CreateOrder(param string) (orderID string, err error) {
-	log.Printf("Order %s created", param)
-
-	// create order implementation
+func (s *Service) CreateOrder(ctx context.Context, param string) (orderID string, err error) {
 	orderID = uuid.NewString()
 
-	s.wg.Add(1)
-	safe.GoFunc(func() {
-		s.wg.Done()
-		s.doPayment(param)
+	// The order and its event are committed together, the outbox relay publishes the event afterwards
+	err = s.mongo.WithTransaction(ctx, func(ctx context.Context) error {
+		order := map[string]interface{}{
+			"_id":        orderID,
+			"param":      param,
+			"status":     "created",
+			"created_at": time.Now().UTC(),
+		}
+		if _, err := s.mongo.Collection("orders").InsertOne(ctx, order); err != nil {
+			return err
+		}
+		env, err := event.New(&event.OrderCreated{OrderID: orderID, Status: "created"}, orderID)
+		if err != nil {
+			return err
+		}
+		msg, err := event.EncodeMessage(env, s.eventContentType)
+		if err != nil {
+			return err
+		}
+		ref := map[string]string{"order_id": orderID, queue.ContentTypeKey: msg.ContentType}
+		for k, v := range msg.Headers {
+			ref[k] = v
+		}
+		// The event type doubles as the routing key
+		return s.outbox.Add(ctx, outbox.NewMessage(env.ID, env.Type, env.Type, msg.Body, ref))
 	})
+	if err != nil {
+		return "", fmt.Errorf("create order: %w", err)
+	}
+	s.relay.Notify()
+	log.Printf("Order %s created", param)
 
 	s.wg.Add(1)
 	safe.GoFunc(func() {
 		s.wg.Done()
-		s.sendNotification(param)
+		s.doPayment(param)
 	})
 
 	s.wg.Add(1)
 	safe.GoFunc(func() {
 		s.wg.Done()
-		s.rmq.Publish("routingKey", "msgID", "eventName", []byte(fmt.Sprintf(`{"orderId":%s, "status":"created"}`, orderID)), nil)
+		s.sendNotification(param)
 	})
 
 	return orderID, nil
@@ -171,6 +247,7 @@ func (s *Service) Shutdown(ctx context.Context) {
 	go func() {
 		s.wg.Wait()
 		s.workerPool.Shutdown()
+		s.relay.Stop(ctx)
 		close(done)
 	}()
 
@@ -1,15 +1,21 @@
 package workerpool
 
 import (
+	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
 )
 
+// ErrPoolPaused is returned by Submit while the pool is not accepting tasks
+var ErrPoolPaused = errors.New("worker pool is paused")
+
 // WorkerPool defines a simple worker pool
 type WorkerPool struct {
 	taskQueue chan func()
 	wg        sync.WaitGroup
 	once      sync.Once
+	paused    atomic.Bool
 }
 
 // NewWorkerPool initializes a worker pool with a fixed number of workers
@@ -36,8 +42,22 @@ func (wp *WorkerPool) worker(id int) {
 }
 
 // Submit adds a new task to the worker pool queue
-func (wp *WorkerPool) Submit(task func()) {
+func (wp *WorkerPool) Submit(task func()) error {
+	if wp.paused.Load() {
+		return ErrPoolPaused
+	}
 	wp.taskQueue <- task
+	return nil
+}
+
+// Pause stops the pool from accepting new tasks; queued tasks still run
+func (wp *WorkerPool) Pause() {
+	wp.paused.Store(true)
+}
+
+// Resume lets the pool accept new tasks again
+func (wp *WorkerPool) Resume() {
+	wp.paused.Store(false)
 }
 
 // Shutdown gracefully stops the worker pool